@@ -0,0 +1,522 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/pennsieve/dbmigrate-go/pkg/config"
+	"github.com/pennsieve/dbmigrate-go/pkg/dbmigrate"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errUsage is returned by commands given the wrong arguments. The message has already been printed.
+var errUsage = errors.New("usage error")
+
+// errNoChange is returned by commands that found the schema already at the target version.
+var errNoChange = errors.New("no change")
+
+// errDirty is returned by commands that found or left the schema dirty.
+var errDirty = errors.New("schema is dirty")
+
+// versionFormat is the format of the version prefix of files made by create, matching the existing migrations.
+const versionFormat = "20060102150405"
+
+// cli holds what every command needs.
+type cli struct {
+	migrateConfig  config.Config
+	migrationsPath string
+	stdin          io.Reader
+	stdout         io.Writer
+	stderr         io.Writer
+	logger         *slog.Logger
+}
+
+// command is a dbmigrate subcommand. Commands that need the database are given a DatabaseMigrator.
+type command struct {
+	needsDB bool
+	run     func(ctx context.Context, c *cli, m *dbmigrate.DatabaseMigrator, args []string) error
+}
+
+var commands = map[string]command{
+	"up":     {needsDB: true, run: runUp},
+	"down":   {needsDB: true, run: runDown},
+	"goto":   {needsDB: true, run: runGoto},
+	"steps":  {needsDB: true, run: runSteps},
+	"status": {needsDB: true, run: runStatus},
+	"force":  {needsDB: true, run: runForce},
+	"drop":   {needsDB: true, run: runDrop},
+	"create": {run: runCreate},
+	"lint":   {run: runLint},
+}
+
+// commandUsages are the usage lines of the commands, in the order they are listed in the help.
+var commandUsages = []struct{ name, usage string }{
+	{"up", "up"},
+	{"down", "down [-f]"},
+	{"goto", "goto <version>"},
+	{"steps", "steps <n>"},
+	{"status", "status [-json]"},
+	{"force", "force <version>"},
+	{"drop", "drop [-f]"},
+	{"create", "create <name>"},
+	{"lint", "lint [-db] [-json] [-severity <rule>=<error|warning|off>]..."},
+}
+
+// run runs the command line args, reading any settings not in the environment or flags from
+// defaultSettings, and returns the exit code.
+func run(ctx context.Context, args []string, defaultSettings config.DefaultSettings, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("dbmigrate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	migrationsPath := flags.String("path", "migrations", "directory containing the migration files")
+	host := flags.String("host", "", "Postgres host, overrides "+config.PostgresHostKey)
+	port := flags.Int("port", 0, "Postgres port, overrides "+config.PostgresPortKey)
+	user := flags.String("user", "", "Postgres user, overrides "+config.PostgresUserKey)
+	password := flags.String("password", "", "Postgres password, overrides "+config.PostgresPasswordKey+". If no password is set, an RDS auth token is used")
+	database := flags.String("database", "", "Postgres database, overrides "+config.PostgresDatabaseKey)
+	schema := flags.String("schema", "", "schema to migrate, overrides "+config.PostgresSchemaKey)
+	sslMode := flags.String("sslmode", "", "libpq sslmode, overrides "+config.PostgresSSLModeKey)
+	verbose := flags.Bool("verbose", false, "log golang-migrate's verbose messages, overrides "+config.VerboseLoggingKey)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: dbmigrate [flags] <command> [arguments]")
+		fmt.Fprintln(stderr, "\nCommands:")
+		for _, command := range commandUsages {
+			fmt.Fprintf(stderr, "  %s\n", command.usage)
+		}
+		fmt.Fprintln(stderr, "\nFlags:")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitSuccess
+		}
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	name := flags.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "dbmigrate: unknown command %q\n", name)
+		flags.Usage()
+		return exitUsage
+	}
+
+	migrateConfig, err := config.LoadConfig(defaultSettings)
+	if err != nil {
+		fmt.Fprintf(stderr, "dbmigrate: error loading config: %v\n", err)
+		return exitFailure
+	}
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "host":
+			migrateConfig.PostgresDB.Host = *host
+		case "port":
+			migrateConfig.PostgresDB.Port = *port
+		case "user":
+			migrateConfig.PostgresDB.User = *user
+		case "password":
+			// as with the env var, an empty password means RDS auth
+			migrateConfig.PostgresDB.Password = nil
+			if len(*password) > 0 {
+				migrateConfig.PostgresDB.Password = password
+			}
+		case "database":
+			migrateConfig.PostgresDB.Database = *database
+		case "schema":
+			migrateConfig.PostgresDB.Schema = *schema
+		case "sslmode":
+			migrateConfig.PostgresDB.SSLMode = *sslMode
+		case "verbose":
+			migrateConfig.VerboseLogging = *verbose
+		}
+	})
+
+	level := slog.LevelInfo
+	if migrateConfig.VerboseLogging {
+		level = slog.LevelDebug
+	}
+	c := &cli{
+		migrateConfig:  migrateConfig,
+		migrationsPath: *migrationsPath,
+		stdin:          stdin,
+		stdout:         stdout,
+		stderr:         stderr,
+		logger:         slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: level})),
+	}
+
+	var migrator *dbmigrate.DatabaseMigrator
+	if cmd.needsDB {
+		if migrator, err = c.newMigrator(ctx); err != nil {
+			fmt.Fprintf(stderr, "dbmigrate: %v\n", err)
+			return exitFailure
+		}
+		defer migrator.CloseAndLogError()
+	}
+	return exitCode(cmd.run(ctx, c, migrator, flags.Args()[1:]), stderr)
+}
+
+// exitCode prints err, if any, and returns the exit code for it.
+func exitCode(err error, stderr io.Writer) int {
+	switch {
+	case err == nil:
+		return exitSuccess
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case errors.Is(err, errNoChange):
+		return exitNoChange
+	}
+	fmt.Fprintf(stderr, "dbmigrate: %v\n", err)
+	if errors.Is(err, errDirty) {
+		return exitDirty
+	}
+	return exitFailure
+}
+
+// newMigrator returns a DatabaseMigrator for the migrations directory, authenticating with the configured
+// password if there is one, or else with an RDS auth token.
+func (c *cli) newMigrator(ctx context.Context) (*dbmigrate.DatabaseMigrator, error) {
+	migrationsSource, err := iofs.New(os.DirFS(c.migrationsPath), ".")
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations from %s: %w", c.migrationsPath, err)
+	}
+	opts := []dbmigrate.Option{dbmigrate.WithLogger(c.logger)}
+	if c.migrateConfig.PostgresDB.Password != nil {
+		return dbmigrate.NewLocalMigrator(ctx, c.migrateConfig, migrationsSource, opts...)
+	}
+	awsConfig, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error loading AWS config for RDS auth: %w", err)
+	}
+	return dbmigrate.NewRDSProxyDatabaseMigrator(ctx, c.migrateConfig, migrationsSource, awsConfig, opts...)
+}
+
+// usageError prints the usage of the named command and returns errUsage.
+func (c *cli) usageError(name string, format string, args ...any) error {
+	fmt.Fprintf(c.stderr, "dbmigrate: %s\n", fmt.Sprintf(format, args...))
+	for _, command := range commandUsages {
+		if command.name == name {
+			fmt.Fprintf(c.stderr, "Usage: dbmigrate [flags] %s\n", command.usage)
+		}
+	}
+	return errUsage
+}
+
+// confirm asks the user to confirm a destructive command unless force is set.
+func (c *cli) confirm(force bool, question string) bool {
+	if force {
+		return true
+	}
+	fmt.Fprintf(c.stdout, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(c.stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// migrateAndCheck runs f and reports whether it changed the version or left the schema dirty.
+func migrateAndCheck(ctx context.Context, m *dbmigrate.DatabaseMigrator, f func() error) error {
+	before, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if before.Dirty {
+		return fmt.Errorf("%w: version %d must be recovered before migrating", errDirty, before.Version)
+	}
+	if err := f(); err != nil {
+		var dirtyErr migrate.ErrDirty
+		if errors.As(err, &dirtyErr) {
+			return fmt.Errorf("%w: %v", errDirty, err)
+		}
+		if state, stateErr := m.DirtyState(); stateErr == nil && state != nil {
+			return fmt.Errorf("%w: %s: %v", errDirty, state, err)
+		}
+		return err
+	}
+	after, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if after.HasVersion == before.HasVersion && after.Version == before.Version {
+		return errNoChange
+	}
+	return nil
+}
+
+// noArgs returns a usage error if the named command was given arguments.
+func noArgs(c *cli, name string, args []string) error {
+	if len(args) > 0 {
+		return c.usageError(name, "unexpected arguments %v", args)
+	}
+	return nil
+}
+
+func runUp(ctx context.Context, c *cli, m *dbmigrate.DatabaseMigrator, args []string) error {
+	if err := noArgs(c, "up", args); err != nil {
+		return err
+	}
+	return migrateAndCheck(ctx, m, func() error {
+		return m.UpContext(ctx)
+	})
+}
+
+func runDown(ctx context.Context, c *cli, m *dbmigrate.DatabaseMigrator, args []string) error {
+	flags := flag.NewFlagSet("down", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	force := flags.Bool("f", false, "do not ask for confirmation")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if err := noArgs(c, "down", flags.Args()); err != nil {
+		return err
+	}
+	if !c.confirm(*force, "Roll back all applied migrations?") {
+		return errors.New("down cancelled")
+	}
+	return migrateAndCheck(ctx, m, func() error {
+		return m.DownContext(ctx)
+	})
+}
+
+func runGoto(ctx context.Context, c *cli, m *dbmigrate.DatabaseMigrator, args []string) error {
+	if len(args) != 1 {
+		return c.usageError("goto", "expected a version")
+	}
+	version, err := strconv.ParseUint(args[0], 10, 0)
+	if err != nil {
+		return c.usageError("goto", "invalid version %q", args[0])
+	}
+	return migrateAndCheck(ctx, m, func() error {
+		return m.MigrateContext(ctx, uint(version))
+	})
+}
+
+func runSteps(ctx context.Context, c *cli, m *dbmigrate.DatabaseMigrator, args []string) error {
+	// args are not parsed as flags so that a negative n is accepted
+	if len(args) != 1 {
+		return c.usageError("steps", "expected a number of steps")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n == 0 {
+		return c.usageError("steps", "invalid number of steps %q", args[0])
+	}
+	return migrateAndCheck(ctx, m, func() error {
+		return m.StepsContext(ctx, n)
+	})
+}
+
+func runStatus(ctx context.Context, c *cli, m *dbmigrate.DatabaseMigrator, args []string) error {
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	asJSON := flags.Bool("json", false, "print the status as JSON")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if err := noArgs(c, "status", flags.Args()); err != nil {
+		return err
+	}
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(c.stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(status); err != nil {
+			return err
+		}
+	} else {
+		writeStatus(c.stdout, status)
+	}
+	if status.Dirty {
+		return fmt.Errorf("%w: version %d", errDirty, status.Version)
+	}
+	return nil
+}
+
+func writeStatus(w io.Writer, status *dbmigrate.Status) {
+	switch {
+	case !status.HasVersion:
+		fmt.Fprintln(w, "version: none")
+	case status.Dirty:
+		fmt.Fprintf(w, "version: %d (dirty)\n", status.Version)
+	default:
+		fmt.Fprintf(w, "version: %d\n", status.Version)
+	}
+	for _, migration := range status.Applied {
+		fmt.Fprintf(w, "applied  %d %s\n", migration.Version, migration.Identifier)
+	}
+	for _, migration := range status.Pending {
+		fmt.Fprintf(w, "pending  %d %s\n", migration.Version, migration.Identifier)
+	}
+}
+
+func runForce(_ context.Context, c *cli, m *dbmigrate.DatabaseMigrator, args []string) error {
+	if len(args) != 1 {
+		return c.usageError("force", "expected a version")
+	}
+	version, err := strconv.Atoi(args[0])
+	if err != nil || version < -1 {
+		return c.usageError("force", "invalid version %q", args[0])
+	}
+	return m.Force(version)
+}
+
+func runDrop(_ context.Context, c *cli, m *dbmigrate.DatabaseMigrator, args []string) error {
+	flags := flag.NewFlagSet("drop", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	force := flags.Bool("f", false, "do not ask for confirmation")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if err := noArgs(c, "drop", flags.Args()); err != nil {
+		return err
+	}
+	if !c.confirm(*force, fmt.Sprintf("Drop all tables in schema %q?", c.migrateConfig.PostgresDB.Schema)) {
+		return errors.New("drop cancelled")
+	}
+	return m.Drop()
+}
+
+// migrationName is what create accepts as a migration name, after lower casing and replacing spaces.
+var migrationName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+func runCreate(_ context.Context, c *cli, _ *dbmigrate.DatabaseMigrator, args []string) error {
+	if len(args) != 1 {
+		return c.usageError("create", "expected a migration name")
+	}
+	name := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(args[0])), " ", "_")
+	if !migrationName.MatchString(name) {
+		return c.usageError("create", "invalid migration name %q: use letters, digits and underscores", args[0])
+	}
+	if err := os.MkdirAll(c.migrationsPath, 0o755); err != nil {
+		return fmt.Errorf("error creating migrations directory: %w", err)
+	}
+	version, err := nextVersion(c.migrationsPath, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	for _, direction := range []dbmigrate.Direction{dbmigrate.DirectionUp, dbmigrate.DirectionDown} {
+		path := filepath.Join(c.migrationsPath, fmt.Sprintf("%s_%s.%s.sql", version, name, direction))
+		// O_EXCL so that an existing migration is never overwritten
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return fmt.Errorf("error creating migration file: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("error creating migration file: %w", err)
+		}
+		fmt.Fprintln(c.stdout, path)
+	}
+	return nil
+}
+
+// nextVersion returns the version for a migration created at now, moved on a second at a time past any
+// version already used by a file in dir, so that migrations created within the same second do not share one.
+func nextVersion(dir string, now time.Time) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("error reading migrations directory: %w", err)
+	}
+	used := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if prefix, _, found := strings.Cut(entry.Name(), "_"); found {
+			used[prefix] = true
+		}
+	}
+	version := now.Format(versionFormat)
+	for used[version] {
+		now = now.Add(time.Second)
+		version = now.Format(versionFormat)
+	}
+	return version, nil
+}
+
+// severityFlags is a repeatable -severity flag of the form rule=severity.
+type severityFlags []dbmigrate.LintOption
+
+func (f *severityFlags) String() string {
+	return ""
+}
+
+func (f *severityFlags) Set(value string) error {
+	rule, severity, found := strings.Cut(value, "=")
+	if !found {
+		return fmt.Errorf("expected <rule>=<severity>, got %q", value)
+	}
+	if !slices.Contains(dbmigrate.LintRules(), dbmigrate.LintRule(rule)) {
+		return fmt.Errorf("unknown rule %q", rule)
+	}
+	switch s := dbmigrate.Severity(severity); s {
+	case dbmigrate.SeverityError, dbmigrate.SeverityWarning, dbmigrate.SeverityOff:
+		*f = append(*f, dbmigrate.WithSeverity(dbmigrate.LintRule(rule), s))
+		return nil
+	}
+	return fmt.Errorf("unknown severity %q", severity)
+}
+
+func runLint(ctx context.Context, c *cli, _ *dbmigrate.DatabaseMigrator, args []string) error {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	useDB := flags.Bool("db", false, "also connect to the database to find unapplied migrations older than the applied version")
+	asJSON := flags.Bool("json", false, "print the findings as JSON")
+	var severities severityFlags
+	flags.Var(&severities, "severity", "change the severity of a rule, for example missing-down=warning. May be repeated")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if err := noArgs(c, "lint", flags.Args()); err != nil {
+		return err
+	}
+
+	report, err := dbmigrate.LintFS(os.DirFS(c.migrationsPath), ".", severities...)
+	if err != nil {
+		return err
+	}
+	if *useDB {
+		m, err := c.newMigrator(ctx)
+		if err != nil {
+			return err
+		}
+		defer m.CloseAndLogError()
+		dbReport, err := m.Lint(ctx, severities...)
+		if err != nil {
+			return err
+		}
+		// LintFS has already checked the files, so only the check that needs the database is added
+		for _, finding := range dbReport.Findings {
+			if finding.Rule == dbmigrate.RuleBelowApplied {
+				report.Findings = append(report.Findings, finding)
+			}
+		}
+		report.Sort()
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(c.stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else if err := report.WriteText(c.stdout); err != nil {
+		return err
+	}
+	if report.HasErrors() {
+		return errors.New("lint found errors")
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/pennsieve/dbmigrate-go/pkg/dbmigrate"
+	"github.com/pennsieve/dbmigrate-go/pkg/dbmigratetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const schema = "cli_test_schema"
+
+// cliResult is the exit code and output of a single run of the CLI
+type cliResult struct {
+	code   int
+	stdout string
+	stderr string
+}
+
+func runCLI(t *testing.T, args ...string) cliResult {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, dbmigratetest.NewTestSettings(schema), strings.NewReader(""), &stdout, &stderr)
+	return cliResult{code: code, stdout: stdout.String(), stderr: stderr.String()}
+}
+
+func TestRun_Usage(t *testing.T) {
+	tests := []struct {
+		scenario string
+		args     []string
+		expected int
+	}{
+		{"no command", nil, exitUsage},
+		{"unknown command", []string{"sideways"}, exitUsage},
+		{"unknown flag", []string{"-nope", "up"}, exitUsage},
+		{"help", []string{"-h"}, exitSuccess},
+		{"create without name", []string{"-path", t.TempDir(), "create"}, exitUsage},
+		{"create with invalid name", []string{"-path", t.TempDir(), "create", "drop-table;"}, exitUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			result := runCLI(t, tt.args...)
+			assert.Equal(t, tt.expected, result.code, result.stderr)
+			assert.Contains(t, result.stderr, "Usage: dbmigrate [flags]")
+		})
+	}
+}
+
+func TestRun_Create(t *testing.T) {
+	migrationsPath := filepath.Join(t.TempDir(), "migrations")
+
+	result := runCLI(t, "-path", migrationsPath, "create", "Add Users Table")
+	require.Equal(t, exitSuccess, result.code, result.stderr)
+
+	entries, err := os.ReadDir(migrationsPath)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	filePattern := regexp.MustCompile(`^(\d{14})_add_users_table\.(up|down)\.sql$`)
+	var versions []string
+	for _, entry := range entries {
+		matches := filePattern.FindStringSubmatch(entry.Name())
+		require.NotNil(t, matches, entry.Name())
+		versions = append(versions, matches[1])
+		assert.Contains(t, result.stdout, filepath.Join(migrationsPath, entry.Name()))
+	}
+	assert.Equal(t, versions[0], versions[1])
+
+	t.Run("same second", func(t *testing.T) {
+		migrationsPath := filepath.Join(t.TempDir(), "migrations")
+
+		for _, name := range []string{"first", "second", "third"} {
+			result := runCLI(t, "-path", migrationsPath, "create", name)
+			require.Equal(t, exitSuccess, result.code, result.stderr)
+		}
+
+		entries, err := os.ReadDir(migrationsPath)
+		require.NoError(t, err)
+		require.Len(t, entries, 6)
+		versionNames := map[string]string{}
+		for _, entry := range entries {
+			version, name, _ := strings.Cut(strings.Split(entry.Name(), ".")[0], "_")
+			if existing, seen := versionNames[version]; seen {
+				assert.Equal(t, existing, name, "version %s is used by two migrations", version)
+			}
+			versionNames[version] = name
+		}
+		assert.Len(t, versionNames, 3)
+	})
+}
+
+func TestRun_Migrations(t *testing.T) {
+	migrationsPath := filepath.Join("..", "..", "pkg", "dbmigrate", "testdata", "migrations")
+	t.Cleanup(func() {
+		runCLI(t, "-path", migrationsPath, "drop", "-f")
+	})
+
+	result := runCLI(t, "-path", migrationsPath, "up")
+	require.Equal(t, exitSuccess, result.code, result.stderr)
+
+	result = runCLI(t, "-path", migrationsPath, "up")
+	require.Equal(t, exitNoChange, result.code, result.stderr)
+
+	result = runCLI(t, "-path", migrationsPath, "status", "-json")
+	require.Equal(t, exitSuccess, result.code, result.stderr)
+	var status dbmigrate.Status
+	require.NoError(t, json.Unmarshal([]byte(result.stdout), &status))
+	assert.Equal(t, uint(20250509172500), status.Version)
+	assert.Len(t, status.Applied, 2)
+	assert.Empty(t, status.Pending)
+
+	result = runCLI(t, "-path", migrationsPath, "steps", "-1")
+	require.Equal(t, exitSuccess, result.code, result.stderr)
+
+	result = runCLI(t, "-path", migrationsPath, "status")
+	require.Equal(t, exitSuccess, result.code, result.stderr)
+	assert.Equal(t, "version: 20250319124829\n"+
+		"applied  20250319124829 create_updated_at_trigger\n"+
+		"pending  20250509172500 create_table\n", result.stdout)
+
+	result = runCLI(t, "-path", migrationsPath, "goto", "20250509172500")
+	require.Equal(t, exitSuccess, result.code, result.stderr)
+
+	result = runCLI(t, "-path", migrationsPath, "steps", "x")
+	require.Equal(t, exitUsage, result.code, result.stderr)
+
+	result = runCLI(t, "-path", migrationsPath, "down", "-f")
+	require.Equal(t, exitSuccess, result.code, result.stderr)
+
+	result = runCLI(t, "-path", migrationsPath, "down", "-f")
+	require.Equal(t, exitNoChange, result.code, result.stderr)
+}
+
+func TestRun_Dirty(t *testing.T) {
+	migrationsPath := filepath.Join("..", "..", "pkg", "dbmigrate", "testdata", "failing_migrations")
+	t.Cleanup(func() {
+		runCLI(t, "-path", migrationsPath, "drop", "-f")
+	})
+
+	result := runCLI(t, "-path", migrationsPath, "up")
+	require.Equal(t, exitDirty, result.code, result.stderr)
+
+	result = runCLI(t, "-path", migrationsPath, "status")
+	require.Equal(t, exitDirty, result.code, result.stderr)
+	assert.Contains(t, result.stdout, "version: 20250601110000 (dirty)")
+
+	result = runCLI(t, "-path", migrationsPath, "up")
+	require.Equal(t, exitDirty, result.code, result.stderr)
+
+	result = runCLI(t, "-path", migrationsPath, "force", "20250601100000")
+	require.Equal(t, exitSuccess, result.code, result.stderr)
+
+	result = runCLI(t, "-path", migrationsPath, "status")
+	require.Equal(t, exitSuccess, result.code, result.stderr)
+}
+
+func TestRun_ConfirmDrop(t *testing.T) {
+	migrationsPath := filepath.Join("..", "..", "pkg", "dbmigrate", "testdata", "migrations")
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"-path", migrationsPath, "drop"}, dbmigratetest.NewTestSettings(schema), strings.NewReader("n\n"), &stdout, &stderr)
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, stdout.String(), `Drop all tables in schema "cli_test_schema"? [y/N]`)
+	assert.Contains(t, stderr.String(), "drop cancelled")
+}
+
+func TestRun_Lint(t *testing.T) {
+	migrationsPath := t.TempDir()
+	for name, body := range map[string]string{
+		"20250101000000_ok.up.sql":      "CREATE TABLE ok (id INT);",
+		"20250101000000_ok.down.sql":    "DROP TABLE ok;",
+		"20250102000000_no_down.up.sql": "CREATE TABLE no_down (id INT);",
+		"20250103000000_empty.up.sql":   "",
+		"20250103000000_empty.down.sql": "SELECT 1;",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(migrationsPath, name), []byte(body), 0o644))
+	}
+
+	result := runCLI(t, "-path", migrationsPath, "lint")
+	assert.Equal(t, exitFailure, result.code)
+	assert.Equal(t, "error 20250102000000_no_down.up.sql: no down migration (missing-down)\n"+
+		"warning 20250103000000_empty.up.sql: file has no statements (empty-file)\n", result.stdout)
+	assert.Contains(t, result.stderr, "lint found errors")
+
+	result = runCLI(t, "-path", migrationsPath, "lint", "-severity", "missing-down=warning", "-severity", "empty-file=off")
+	assert.Equal(t, exitSuccess, result.code, result.stderr)
+	assert.Equal(t, "warning 20250102000000_no_down.up.sql: no down migration (missing-down)\n", result.stdout)
+
+	result = runCLI(t, "-path", migrationsPath, "lint", "-severity", "missing-down=fatal")
+	assert.Equal(t, exitUsage, result.code)
+
+	result = runCLI(t, "-path", "../../pkg/dbmigrate/testdata/migrations", "lint", "-json")
+	assert.Equal(t, exitSuccess, result.code, result.stderr)
+	assert.JSONEq(t, `{"findings": []}`, result.stdout)
+}
@@ -0,0 +1,55 @@
+// Command dbmigrate runs the migrations in a directory against a Postgres schema.
+//
+// Usage:
+//
+//	dbmigrate [flags] <command> [arguments]
+//
+// The database connection is configured with the environment variables read by config.LoadConfig,
+// which flags override. If no password is configured, dbmigrate connects with an RDS IAM auth token
+// using the default AWS credentials.
+//
+// Commands:
+//
+//	up                apply all pending migrations
+//	down [-f]         roll back all applied migrations
+//	goto <version>    migrate up or down to version
+//	steps <n>         apply n migrations, or roll back -n if n is negative
+//	status [-json]    print the applied and pending migrations
+//	force <version>   record version as applied and clean without running anything, -1 for none
+//	drop [-f]         drop all tables in the schema
+//	create <name>     create empty up and down migration files in the migrations directory
+//	lint [-db]        check the migration files for problems such as missing down migrations or
+//	                  statements that lock or rewrite live tables
+//
+// Exit codes:
+//
+//	0  success
+//	1  failure, including lint errors
+//	2  usage error
+//	3  nothing to do, the schema was already at the target version
+//	4  the schema is dirty, either before or after the command
+package main
+
+import (
+	"context"
+	"github.com/pennsieve/dbmigrate-go/pkg/config"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+const (
+	exitSuccess  = 0
+	exitFailure  = 1
+	exitUsage    = 2
+	exitNoChange = 3
+	exitDirty    = 4
+)
+
+func main() {
+	// a first interrupt stops the run after the current migration
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], config.NewDefaultSettings(), os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
@@ -5,6 +5,8 @@ const VerboseLoggingKey = "VERBOSE_LOGGING"
 
 type Config struct {
 	PostgresDB     PostgresDBConfig
+	Migration      MigrationConfig
+	ConnectRetry   ConnectRetryConfig
 	VerboseLogging bool
 }
 
@@ -17,8 +19,18 @@ func LoadConfig(defaultSettings DefaultSettings) (Config, error) {
 	if err != nil {
 		return Config{}, err
 	}
+	migrationConfig, err := LoadMigrationConfig(defaultSettings)
+	if err != nil {
+		return Config{}, err
+	}
+	connectRetryConfig, err := LoadConnectRetryConfig(defaultSettings)
+	if err != nil {
+		return Config{}, err
+	}
 	return Config{
 		PostgresDB:     postgresDBConfig,
+		Migration:      migrationConfig,
+		ConnectRetry:   connectRetryConfig,
 		VerboseLogging: isVerbose,
 	}, nil
 }
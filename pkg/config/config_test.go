@@ -10,6 +10,7 @@ import (
 	"os"
 	"strconv"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig_EmptyDefaultSettings(t *testing.T) {
@@ -28,6 +29,15 @@ func TestLoadConfig_EmptyDefaultSettings(t *testing.T) {
 			Database: "postgres",
 			Schema:   "",
 		},
+		Migration: config.MigrationConfig{
+			ChecksumMode: config.ChecksumOff,
+		},
+		ConnectRetry: config.ConnectRetryConfig{
+			MaxAttempts:    1,
+			InitialBackoff: 500 * time.Millisecond,
+			MaxBackoff:     10 * time.Second,
+			Timeout:        0,
+		},
 		VerboseLogging: false,
 	}, emptyConfig)
 }
@@ -36,12 +46,30 @@ func TestLoadConfig_EnvVars(t *testing.T) {
 	expectedPassword := uuid.NewString()
 	expected := config.Config{
 		PostgresDB: config.PostgresDBConfig{
-			Host:     uuid.NewString(),
-			Port:     rand.Intn(6000) + 1,
-			User:     uuid.NewString(),
-			Password: &expectedPassword,
-			Database: uuid.NewString(),
-			Schema:   uuid.NewString(),
+			Host:        uuid.NewString(),
+			Port:        rand.Intn(6000) + 1,
+			User:        uuid.NewString(),
+			Password:    &expectedPassword,
+			Database:    uuid.NewString(),
+			Schema:      uuid.NewString(),
+			SSLMode:     "verify-full",
+			SSLRootCert: uuid.NewString(),
+			SSLCert:     uuid.NewString(),
+			SSLKey:      uuid.NewString(),
+		},
+		Migration: config.MigrationConfig{
+			FloorVersion:     uint(rand.Intn(1000000) + 1),
+			StatementTimeout: time.Duration(rand.Intn(600)+1) * time.Second,
+			LockTimeout:      time.Duration(rand.Intn(60000)+1) * time.Millisecond,
+			History:          true,
+			Actor:            uuid.NewString(),
+			ChecksumMode:     config.ChecksumFail,
+		},
+		ConnectRetry: config.ConnectRetryConfig{
+			MaxAttempts:    rand.Intn(10) + 1,
+			InitialBackoff: time.Duration(rand.Intn(1000)+1) * time.Millisecond,
+			MaxBackoff:     time.Duration(rand.Intn(60)+1) * time.Second,
+			Timeout:        time.Duration(rand.Intn(10)+1) * time.Minute,
 		},
 		VerboseLogging: true,
 	}
@@ -53,6 +81,20 @@ func TestLoadConfig_EnvVars(t *testing.T) {
 	t.Setenv(config.PostgresPasswordKey, *expected.PostgresDB.Password)
 	t.Setenv(config.PostgresDatabaseKey, expected.PostgresDB.Database)
 	t.Setenv(config.PostgresSchemaKey, expected.PostgresDB.Schema)
+	t.Setenv(config.PostgresSSLModeKey, expected.PostgresDB.SSLMode)
+	t.Setenv(config.PostgresSSLRootCertKey, expected.PostgresDB.SSLRootCert)
+	t.Setenv(config.PostgresSSLCertKey, expected.PostgresDB.SSLCert)
+	t.Setenv(config.PostgresSSLKeyKey, expected.PostgresDB.SSLKey)
+	t.Setenv(config.MigrationFloorVersionKey, fmt.Sprintf("%d", expected.Migration.FloorVersion))
+	t.Setenv(config.MigrationStatementTimeoutKey, expected.Migration.StatementTimeout.String())
+	t.Setenv(config.MigrationLockTimeoutKey, expected.Migration.LockTimeout.String())
+	t.Setenv(config.MigrationHistoryKey, strconv.FormatBool(expected.Migration.History))
+	t.Setenv(config.MigrationActorKey, expected.Migration.Actor)
+	t.Setenv(config.MigrationChecksumModeKey, string(expected.Migration.ChecksumMode))
+	t.Setenv(config.ConnectMaxAttemptsKey, fmt.Sprintf("%d", expected.ConnectRetry.MaxAttempts))
+	t.Setenv(config.ConnectInitialBackoffKey, expected.ConnectRetry.InitialBackoff.String())
+	t.Setenv(config.ConnectMaxBackoffKey, expected.ConnectRetry.MaxBackoff.String())
+	t.Setenv(config.ConnectTimeoutKey, expected.ConnectRetry.Timeout.String())
 
 	envConfig, err := config.LoadConfig(config.NewDefaultSettings())
 	require.NoError(t, err)
@@ -63,12 +105,30 @@ func TestLoadConfig_DefaultSettings(t *testing.T) {
 	expectedPassword := uuid.NewString()
 	expected := config.Config{
 		PostgresDB: config.PostgresDBConfig{
-			Host:     uuid.NewString(),
-			Port:     rand.Intn(6000) + 1,
-			User:     uuid.NewString(),
-			Password: &expectedPassword,
-			Database: uuid.NewString(),
-			Schema:   uuid.NewString(),
+			Host:        uuid.NewString(),
+			Port:        rand.Intn(6000) + 1,
+			User:        uuid.NewString(),
+			Password:    &expectedPassword,
+			Database:    uuid.NewString(),
+			Schema:      uuid.NewString(),
+			SSLMode:     "verify-full",
+			SSLRootCert: uuid.NewString(),
+			SSLCert:     uuid.NewString(),
+			SSLKey:      uuid.NewString(),
+		},
+		Migration: config.MigrationConfig{
+			FloorVersion:     uint(rand.Intn(1000000) + 1),
+			StatementTimeout: time.Duration(rand.Intn(600)+1) * time.Second,
+			LockTimeout:      time.Duration(rand.Intn(60000)+1) * time.Millisecond,
+			History:          true,
+			Actor:            uuid.NewString(),
+			ChecksumMode:     config.ChecksumFail,
+		},
+		ConnectRetry: config.ConnectRetryConfig{
+			MaxAttempts:    rand.Intn(10) + 1,
+			InitialBackoff: time.Duration(rand.Intn(1000)+1) * time.Millisecond,
+			MaxBackoff:     time.Duration(rand.Intn(60)+1) * time.Second,
+			Timeout:        time.Duration(rand.Intn(10)+1) * time.Minute,
 		},
 		VerboseLogging: true,
 	}
@@ -80,6 +140,20 @@ func TestLoadConfig_DefaultSettings(t *testing.T) {
 	settings[config.PostgresPasswordKey] = *expected.PostgresDB.Password
 	settings[config.PostgresDatabaseKey] = expected.PostgresDB.Database
 	settings[config.PostgresSchemaKey] = expected.PostgresDB.Schema
+	settings[config.PostgresSSLModeKey] = expected.PostgresDB.SSLMode
+	settings[config.PostgresSSLRootCertKey] = expected.PostgresDB.SSLRootCert
+	settings[config.PostgresSSLCertKey] = expected.PostgresDB.SSLCert
+	settings[config.PostgresSSLKeyKey] = expected.PostgresDB.SSLKey
+	settings[config.MigrationFloorVersionKey] = fmt.Sprintf("%d", expected.Migration.FloorVersion)
+	settings[config.MigrationStatementTimeoutKey] = expected.Migration.StatementTimeout.String()
+	settings[config.MigrationLockTimeoutKey] = expected.Migration.LockTimeout.String()
+	settings[config.MigrationHistoryKey] = strconv.FormatBool(expected.Migration.History)
+	settings[config.MigrationActorKey] = expected.Migration.Actor
+	settings[config.MigrationChecksumModeKey] = string(expected.Migration.ChecksumMode)
+	settings[config.ConnectMaxAttemptsKey] = fmt.Sprintf("%d", expected.ConnectRetry.MaxAttempts)
+	settings[config.ConnectInitialBackoffKey] = expected.ConnectRetry.InitialBackoff.String()
+	settings[config.ConnectMaxBackoffKey] = expected.ConnectRetry.MaxBackoff.String()
+	settings[config.ConnectTimeoutKey] = expected.ConnectRetry.Timeout.String()
 
 	// Need to unset vars for CI
 	unsetConfigEnvVars(t)
@@ -109,4 +183,58 @@ func unsetConfigEnvVars(t *testing.T) {
 	unsetenv(t, config.PostgresPasswordKey)
 	unsetenv(t, config.PostgresDatabaseKey)
 	unsetenv(t, config.PostgresSchemaKey)
+	unsetenv(t, config.PostgresSSLModeKey)
+	unsetenv(t, config.PostgresSSLRootCertKey)
+	unsetenv(t, config.PostgresSSLCertKey)
+	unsetenv(t, config.PostgresSSLKeyKey)
+	unsetenv(t, config.MigrationFloorVersionKey)
+	unsetenv(t, config.MigrationStatementTimeoutKey)
+	unsetenv(t, config.MigrationLockTimeoutKey)
+	unsetenv(t, config.MigrationHistoryKey)
+	unsetenv(t, config.MigrationActorKey)
+	unsetenv(t, config.MigrationChecksumModeKey)
+	unsetenv(t, config.ConnectMaxAttemptsKey)
+	unsetenv(t, config.ConnectInitialBackoffKey)
+	unsetenv(t, config.ConnectMaxBackoffKey)
+	unsetenv(t, config.ConnectTimeoutKey)
+}
+
+func TestLoadConfig_InvalidFloorVersion(t *testing.T) {
+	unsetConfigEnvVars(t)
+	t.Setenv(config.MigrationFloorVersionKey, "-1")
+
+	_, err := config.LoadConfig(config.NewDefaultSettings())
+	require.ErrorContains(t, err, config.MigrationFloorVersionKey)
+}
+
+func TestLoadConfig_InvalidTimeout(t *testing.T) {
+	unsetConfigEnvVars(t)
+	t.Setenv(config.MigrationStatementTimeoutKey, "30")
+
+	_, err := config.LoadConfig(config.NewDefaultSettings())
+	require.ErrorContains(t, err, config.MigrationStatementTimeoutKey)
+}
+
+func TestLoadConfig_InvalidChecksumMode(t *testing.T) {
+	unsetConfigEnvVars(t)
+	t.Setenv(config.MigrationChecksumModeKey, "strict")
+
+	_, err := config.LoadConfig(config.NewDefaultSettings())
+	require.ErrorContains(t, err, config.MigrationChecksumModeKey)
+}
+
+func TestPostgresDBConfigBuilder_SSL(t *testing.T) {
+	unsetConfigEnvVars(t)
+	t.Setenv(config.PostgresSSLModeKey, "require")
+	t.Setenv(config.PostgresSSLRootCertKey, "/env/root.pem")
+
+	pgConfig, err := config.NewPostgresDBConfigBuilder(config.NewDefaultSettings()).
+		WithSSLMode("verify-full").
+		WithSSLClientCert("/etc/certs/client.pem", "/etc/certs/client.key").
+		Build()
+	require.NoError(t, err)
+	assert.Equal(t, "verify-full", pgConfig.SSLMode)
+	assert.Equal(t, "/env/root.pem", pgConfig.SSLRootCert)
+	assert.Equal(t, "/etc/certs/client.pem", pgConfig.SSLCert)
+	assert.Equal(t, "/etc/certs/client.key", pgConfig.SSLKey)
 }
@@ -0,0 +1,57 @@
+package config
+
+import "time"
+
+// ConnectMaxAttemptsKey is the env var for the number of times the migrator will try to connect
+// to the database before giving up. Defaults to 1, that is, no retries.
+const ConnectMaxAttemptsKey = "POSTGRES_CONNECT_MAX_ATTEMPTS"
+
+// ConnectInitialBackoffKey is the env var for how long the migrator waits before its first
+// retry, for example "500ms". The wait doubles after each failed attempt.
+const ConnectInitialBackoffKey = "POSTGRES_CONNECT_INITIAL_BACKOFF"
+
+// ConnectMaxBackoffKey is the env var for the longest the migrator will wait between attempts, for example "10s".
+const ConnectMaxBackoffKey = "POSTGRES_CONNECT_MAX_BACKOFF"
+
+// ConnectTimeoutKey is the env var for the overall deadline for connecting, across all attempts,
+// for example "2m". If this is not set or is set to 0, there is no overall deadline.
+const ConnectTimeoutKey = "POSTGRES_CONNECT_TIMEOUT"
+
+// DefaultConnectInitialBackoff and DefaultConnectMaxBackoff are the waits used when ConnectInitialBackoffKey
+// and ConnectMaxBackoffKey are not set, or when a ConnectRetryConfig leaves them zero.
+const (
+	DefaultConnectInitialBackoff = 500 * time.Millisecond
+	DefaultConnectMaxBackoff     = 10 * time.Second
+)
+
+type ConnectRetryConfig struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Timeout        time.Duration
+}
+
+func LoadConnectRetryConfig(defaultSettings DefaultSettings) (ConnectRetryConfig, error) {
+	maxAttempts, err := getEnvIntOrDefault(ConnectMaxAttemptsKey, defaultSettings.getWithFallback(ConnectMaxAttemptsKey, "1"))
+	if err != nil {
+		return ConnectRetryConfig{}, err
+	}
+	initialBackoff, err := getEnvDurationOrDefault(ConnectInitialBackoffKey, defaultSettings.getWithFallback(ConnectInitialBackoffKey, DefaultConnectInitialBackoff.String()))
+	if err != nil {
+		return ConnectRetryConfig{}, err
+	}
+	maxBackoff, err := getEnvDurationOrDefault(ConnectMaxBackoffKey, defaultSettings.getWithFallback(ConnectMaxBackoffKey, DefaultConnectMaxBackoff.String()))
+	if err != nil {
+		return ConnectRetryConfig{}, err
+	}
+	timeout, err := getEnvDurationOrDefault(ConnectTimeoutKey, defaultSettings.getWithFallback(ConnectTimeoutKey, "0"))
+	if err != nil {
+		return ConnectRetryConfig{}, err
+	}
+	return ConnectRetryConfig{
+		MaxAttempts:    maxAttempts,
+		InitialBackoff: initialBackoff,
+		MaxBackoff:     maxBackoff,
+		Timeout:        timeout,
+	}, nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 )
 
 func getEnvOrDefault(key string, defaultValue string) string {
@@ -33,3 +34,23 @@ func getEnvBoolOrDefault(key string, defaultValue string) (bool, error) {
 	}
 	return value, nil
 }
+
+func getEnvUintOrDefault(key string, defaultValue string) (uint, error) {
+	strValue := getEnvOrDefault(key, defaultValue)
+	value, err := strconv.ParseUint(strValue, 10, 0)
+	if err != nil {
+		return 0, fmt.Errorf("error converting '%s' value '%s' to uint: %w",
+			key, strValue, err)
+	}
+	return uint(value), nil
+}
+
+func getEnvDurationOrDefault(key string, defaultValue string) (time.Duration, error) {
+	strValue := getEnvOrDefault(key, defaultValue)
+	value, err := time.ParseDuration(strValue)
+	if err != nil {
+		return 0, fmt.Errorf("error converting '%s' value '%s' to duration: %w",
+			key, strValue, err)
+	}
+	return value, nil
+}
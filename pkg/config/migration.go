@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// MigrationFloorVersionKey is the env var for the lowest version that relative rollbacks are
+// allowed to leave the schema at. If this is not set or is set to 0, there is no floor.
+const MigrationFloorVersionKey = "MIGRATION_FLOOR_VERSION"
+
+// MigrationStatementTimeoutKey is the env var for the Postgres statement_timeout applied while
+// each migration runs, for example "30s". If this is not set or is set to 0, the server default is used.
+const MigrationStatementTimeoutKey = "MIGRATION_STATEMENT_TIMEOUT"
+
+// MigrationLockTimeoutKey is the env var for the Postgres lock_timeout applied while
+// each migration runs, for example "5s". If this is not set or is set to 0, the server default is used.
+const MigrationLockTimeoutKey = "MIGRATION_LOCK_TIMEOUT"
+
+// MigrationHistoryKey is the env var that turns on the audit history table, which records every
+// migration run. Defaults to false.
+const MigrationHistoryKey = "MIGRATION_HISTORY"
+
+// MigrationActorKey is the env var for the actor or deployment ID recorded in the audit history
+// table alongside each migration, for example a CI job URL. Optional.
+const MigrationActorKey = "MIGRATION_ACTOR"
+
+// MigrationChecksumModeKey is the env var for what to do when an applied migration file no longer
+// matches the checksum recorded when it was applied. One of "off", "warn" or "fail". Defaults to "off".
+const MigrationChecksumModeKey = "MIGRATION_CHECKSUM_MODE"
+
+// ChecksumMode determines whether checksums of applied migrations are recorded, and what happens on
+// Up if a migration file has changed since it was applied.
+type ChecksumMode string
+
+const (
+	// ChecksumOff does not record or verify checksums.
+	ChecksumOff ChecksumMode = "off"
+	// ChecksumWarn records checksums and logs a warning on Up if any have changed.
+	ChecksumWarn ChecksumMode = "warn"
+	// ChecksumFail records checksums and refuses to run Up if any have changed.
+	ChecksumFail ChecksumMode = "fail"
+)
+
+type MigrationConfig struct {
+	FloorVersion     uint
+	StatementTimeout time.Duration
+	LockTimeout      time.Duration
+	History          bool
+	Actor            string
+	ChecksumMode     ChecksumMode
+}
+
+func LoadMigrationConfig(defaultSettings DefaultSettings) (MigrationConfig, error) {
+	floorVersion, err := getEnvUintOrDefault(MigrationFloorVersionKey, defaultSettings.getWithFallback(MigrationFloorVersionKey, "0"))
+	if err != nil {
+		return MigrationConfig{}, err
+	}
+	statementTimeout, err := getEnvDurationOrDefault(MigrationStatementTimeoutKey, defaultSettings.getWithFallback(MigrationStatementTimeoutKey, "0"))
+	if err != nil {
+		return MigrationConfig{}, err
+	}
+	lockTimeout, err := getEnvDurationOrDefault(MigrationLockTimeoutKey, defaultSettings.getWithFallback(MigrationLockTimeoutKey, "0"))
+	if err != nil {
+		return MigrationConfig{}, err
+	}
+	history, err := getEnvBoolOrDefault(MigrationHistoryKey, defaultSettings.getWithFallback(MigrationHistoryKey, "false"))
+	if err != nil {
+		return MigrationConfig{}, err
+	}
+	checksumMode := ChecksumMode(getEnvOrDefault(MigrationChecksumModeKey, defaultSettings.getWithFallback(MigrationChecksumModeKey, string(ChecksumOff))))
+	switch checksumMode {
+	case ChecksumOff, ChecksumWarn, ChecksumFail:
+	default:
+		return MigrationConfig{}, fmt.Errorf("invalid '%s' value '%s': must be one of %q, %q or %q",
+			MigrationChecksumModeKey, checksumMode, ChecksumOff, ChecksumWarn, ChecksumFail)
+	}
+	return MigrationConfig{
+		FloorVersion:     floorVersion,
+		StatementTimeout: statementTimeout,
+		LockTimeout:      lockTimeout,
+		History:          history,
+		Actor:            getEnvOrDefault(MigrationActorKey, defaultSettings.getWithFallback(MigrationActorKey, "")),
+		ChecksumMode:     checksumMode,
+	}, nil
+}
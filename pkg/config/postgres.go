@@ -20,13 +20,32 @@ const PostgresDatabaseKey = "POSTGRES_DATABASE"
 // PostgresSchemaKey is the env var for the schema name the migrator will create if necessary and run in
 const PostgresSchemaKey = "POSTGRES_SCHEMA"
 
+// PostgresSSLModeKey is the env var for the libpq sslmode used to connect with, for example "require" or
+// "verify-full". If this is not set or is set to "", the pgx default is used for local connections
+// and "verify-full" for RDS connections.
+const PostgresSSLModeKey = "POSTGRES_SSLMODE"
+
+// PostgresSSLRootCertKey is the env var for the path of the CA bundle used to verify the server certificate,
+// for example the RDS global bundle.
+const PostgresSSLRootCertKey = "POSTGRES_SSLROOTCERT"
+
+// PostgresSSLCertKey is the env var for the path of the client certificate used to connect with
+const PostgresSSLCertKey = "POSTGRES_SSLCERT"
+
+// PostgresSSLKeyKey is the env var for the path of the client certificate's private key
+const PostgresSSLKeyKey = "POSTGRES_SSLKEY"
+
 type PostgresDBConfig struct {
-	Host     string
-	Port     int
-	User     string
-	Password *string
-	Database string
-	Schema   string
+	Host        string
+	Port        int
+	User        string
+	Password    *string
+	Database    string
+	Schema      string
+	SSLMode     string
+	SSLRootCert string
+	SSLCert     string
+	SSLKey      string
 }
 
 func LoadPostgresDBConfig(defaultSettings DefaultSettings) (PostgresDBConfig, error) {
@@ -70,6 +89,22 @@ func (b *PostgresDBConfigBuilder) WithSchema(schema string) *PostgresDBConfigBui
 	return b
 }
 
+func (b *PostgresDBConfigBuilder) WithSSLMode(sslMode string) *PostgresDBConfigBuilder {
+	b.c.SSLMode = sslMode
+	return b
+}
+
+func (b *PostgresDBConfigBuilder) WithSSLRootCert(sslRootCert string) *PostgresDBConfigBuilder {
+	b.c.SSLRootCert = sslRootCert
+	return b
+}
+
+func (b *PostgresDBConfigBuilder) WithSSLClientCert(sslCert string, sslKey string) *PostgresDBConfigBuilder {
+	b.c.SSLCert = sslCert
+	b.c.SSLKey = sslKey
+	return b
+}
+
 func (b *PostgresDBConfigBuilder) Build() (PostgresDBConfig, error) {
 	if len(b.c.Host) == 0 {
 		b.c.Host = getEnvOrDefault(PostgresHostKey, b.d.getWithFallback(PostgresHostKey, "localhost"))
@@ -98,5 +133,17 @@ func (b *PostgresDBConfigBuilder) Build() (PostgresDBConfig, error) {
 	if len(b.c.Schema) == 0 {
 		b.c.Schema = getEnvOrDefault(PostgresSchemaKey, b.d.get(PostgresSchemaKey))
 	}
+	if len(b.c.SSLMode) == 0 {
+		b.c.SSLMode = getEnvOrDefault(PostgresSSLModeKey, b.d.get(PostgresSSLModeKey))
+	}
+	if len(b.c.SSLRootCert) == 0 {
+		b.c.SSLRootCert = getEnvOrDefault(PostgresSSLRootCertKey, b.d.get(PostgresSSLRootCertKey))
+	}
+	if len(b.c.SSLCert) == 0 {
+		b.c.SSLCert = getEnvOrDefault(PostgresSSLCertKey, b.d.get(PostgresSSLCertKey))
+	}
+	if len(b.c.SSLKey) == 0 {
+		b.c.SSLKey = getEnvOrDefault(PostgresSSLKeyKey, b.d.get(PostgresSSLKeyKey))
+	}
 	return *b.c, nil
 }
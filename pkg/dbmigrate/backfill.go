@@ -0,0 +1,334 @@
+package dbmigrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// backfillsTable records the progress of each Backfill, so that an interrupted backfill resumes where it stopped.
+const backfillsTable = "schema_migrations_backfills"
+
+// defaultBackfillBatchSize is the batch size of a Backfill that does not set one.
+const defaultBackfillBatchSize = 1000
+
+// BackfillDB is what a Backfill runs its batches in. With a *pgxpool.Pool or *pgx.Conn each batch is
+// committed along with the checkpoint, so locks are only held for one batch at a time. With a pgx.Tx
+// each batch is a savepoint, and the whole backfill commits or rolls back with the transaction.
+type BackfillDB interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// BackfillBatch is a batch of rows given to Backfill.Batch.
+type BackfillBatch struct {
+	// First and Last are the keys of the first and last rows of the batch. The rows of the batch are
+	// those with keys from First to Last inclusive, as of when the batch was selected.
+	First any
+	Last  any
+	// Size is the number of rows in the batch, at most the Backfill's BatchSize.
+	Size int
+}
+
+// Backfill updates the rows of a large table in batches, for data changes too big for a single migration
+// transaction. Rows are visited in order of Key, a unique column, using keyset pagination. After each
+// batch the last key is checkpointed in the schema_migrations_backfills table, in the same transaction
+// as the batch, so an interrupted backfill resumes from the next batch when run again. A completed
+// backfill does nothing when run again unless it is Reset.
+//
+// A Backfill can be run after Up with DatabaseMigrator.Backfill, or as a step of a GoMigration that
+// runs without a transaction, so that each batch is committed as it is by DatabaseMigrator.Backfill:
+//
+//	dbmigrate.GoMigration{Version: 20250610120000, Identifier: "backfill_node_ids", UpNoTransaction: backfill.Up, Down: backfill.Reset}
+//
+// If the migration is interrupted the schema is left dirty at its version. Forcing the previous version
+// and running Up again resumes the backfill from its checkpoint.
+type Backfill struct {
+	// Name identifies the backfill in the checkpoint table.
+	Name string
+	// Table is the table to backfill, optionally qualified by schema.
+	Table string
+	// Schema is the schema of the checkpoint table. If empty, it is the schema Table is qualified by, or
+	// failing that the current schema, which for DatabaseMigrator.Backfill and a GoMigration is the
+	// DatabaseMigrator's schema.
+	Schema string
+	// Key is a unique column of Table, usually its primary key.
+	Key string
+	// BatchSize is the most rows in a batch. The default is 1000.
+	BatchSize int
+	// Pause is how long to wait between batches, to give other work a share of the database.
+	Pause time.Duration
+	// Logger reports progress after each batch. DatabaseMigrator.Backfill uses the DatabaseMigrator's
+	// logger if it is nil; otherwise messages go to the standard library's log package.
+	Logger *slog.Logger
+	// Batch updates the rows of batch in tx. If it returns an error the batch is rolled back and the
+	// backfill stops, to resume from the same batch when run again.
+	Batch func(ctx context.Context, tx pgx.Tx, batch BackfillBatch) error
+}
+
+// Run runs the batches of the backfill in db until every row has been visited, ctx is done, or
+// a batch fails.
+func (b Backfill) Run(ctx context.Context, db BackfillDB) error {
+	return b.run(ctx, db, &logger{slog: b.Logger})
+}
+
+// Up runs the backfill on the connection of a GoMigration, committing each batch. It is a GoMigrationConnFunc,
+// for UpNoTransaction.
+func (b Backfill) Up(ctx context.Context, conn *pgx.Conn) error {
+	return b.Run(ctx, conn)
+}
+
+// Reset deletes the checkpoint of the backfill, so that it starts again from the first row when next run.
+// It is a GoMigrationFunc, for the down migration of a backfill run as a GoMigration.
+func (b Backfill) Reset(ctx context.Context, tx pgx.Tx) error {
+	checkpoints, err := b.checkpointsTable(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if err := ensureBackfillsTable(ctx, tx, checkpoints); err != nil {
+		return err
+	}
+	query := `DELETE FROM ` + checkpoints + ` WHERE name = $1`
+	if _, err := tx.Exec(ctx, query, b.Name); err != nil {
+		return fmt.Errorf("error resetting backfill %s: %w", b.Name, err)
+	}
+	return nil
+}
+
+// Backfill runs b on a connection to the DatabaseMigrator's schema, with the configured timeouts applying to
+// each statement. It is meant to be run after Up has made the schema changes b needs, and can be run
+// again to resume b if it was interrupted.
+func (m *DatabaseMigrator) Backfill(ctx context.Context, b Backfill) error {
+	if len(b.Schema) == 0 {
+		b.Schema = m.database.schemaName
+	}
+	log := m.log
+	if b.Logger != nil {
+		log = &logger{slog: b.Logger}
+	}
+	conn, err := m.database.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting connection for backfill: %w", err)
+	}
+	defer conn.Close()
+
+	if err := m.database.setSession(ctx, conn); err != nil {
+		return err
+	}
+	defer m.database.resetSession(conn)
+
+	return withPgxConn(conn, func(pgxConn *pgx.Conn) error {
+		return b.run(ctx, pgxConn, log)
+	})
+}
+
+// backfillQueries are the queries a Backfill selects its batches with.
+type backfillQueries struct {
+	// checkpoints is the qualified checkpoint table
+	checkpoints string
+	// first selects the first batch, and next the batch after the key given as text
+	first string
+	next  string
+}
+
+func (b Backfill) run(ctx context.Context, db BackfillDB, log *logger) error {
+	if len(b.Name) == 0 || len(b.Table) == 0 || len(b.Key) == 0 || b.Batch == nil {
+		return errors.New("a backfill needs a Name, Table, Key and Batch")
+	}
+	started := time.Now()
+	queries, err := b.prepare(ctx, db)
+	if err != nil {
+		return err
+	}
+	batches := 0
+	for {
+		progress, done, err := b.runBatch(ctx, db, queries)
+		if err != nil {
+			return err
+		}
+		if done {
+			log.info(ctx, "backfill complete", slog.String("backfill", b.Name),
+				slog.Int64("rows", progress.rows), slog.Int64("batches", progress.batches),
+				slog.Duration("duration", time.Since(started)))
+			return nil
+		}
+		batches++
+		log.info(ctx, "backfill batch", slog.String("backfill", b.Name),
+			slog.Int64("rows", progress.rows), slog.Int64("batches", progress.batches),
+			slog.String("last_key", progress.lastKey))
+		if b.Pause > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(b.Pause):
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("backfill %s stopped after %d batches: %w", b.Name, batches, context.Cause(ctx))
+		}
+	}
+}
+
+// prepare creates the checkpoint table and the backfill's row in it if needed, and returns the queries for its batches.
+func (b Backfill) prepare(ctx context.Context, db BackfillDB) (backfillQueries, error) {
+	var queries backfillQueries
+	err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		var err error
+		if queries.checkpoints, err = b.checkpointsTable(ctx, tx); err != nil {
+			return err
+		}
+		if err := ensureBackfillsTable(ctx, tx, queries.checkpoints); err != nil {
+			return err
+		}
+		query := `INSERT INTO ` + queries.checkpoints + ` (name) VALUES ($1) ON CONFLICT (name) DO NOTHING`
+		if _, err := tx.Exec(ctx, query, b.Name); err != nil {
+			return fmt.Errorf("error creating checkpoint for backfill %s: %w", b.Name, err)
+		}
+		table := pgx.Identifier(strings.Split(b.Table, ".")).Sanitize()
+		var keyType string
+		query = `SELECT format_type(atttypid, atttypmod) FROM pg_attribute WHERE attrelid = $1::regclass AND attname = $2 AND attnum > 0 AND NOT attisdropped`
+		if err := tx.QueryRow(ctx, query, table, b.Key).Scan(&keyType); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("table %s of backfill %s has no column %s", b.Table, b.Name, b.Key)
+			}
+			return fmt.Errorf("error reading key type of backfill %s: %w", b.Name, err)
+		}
+		key := pgx.Identifier{b.Key}.Sanitize()
+		// the key is also selected as text for the checkpoint, and converted back to keyType to resume
+		selectKeys := fmt.Sprintf(`SELECT %s, %s::text FROM %s`, key, key, table)
+		queries.first = fmt.Sprintf(`%s ORDER BY %s LIMIT $1`, selectKeys, key)
+		queries.next = fmt.Sprintf(`%s WHERE %s > CAST($2::text AS %s) ORDER BY %s LIMIT $1`, selectKeys, key, keyType, key)
+		return nil
+	})
+	return queries, err
+}
+
+// backfillProgress is the checkpoint of a Backfill.
+type backfillProgress struct {
+	lastKey string
+	rows    int64
+	batches int64
+}
+
+// runBatch runs the batch after the checkpoint, and returns the new checkpoint. done is true if there were no more rows.
+func (b Backfill) runBatch(ctx context.Context, db BackfillDB, queries backfillQueries) (progress backfillProgress, done bool, err error) {
+	err = pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		// locking the checkpoint means concurrent runs of the same backfill take turns
+		var lastKey *string
+		var completedAt *time.Time
+		query := `SELECT last_key, rows, batches, completed_at FROM ` + queries.checkpoints + ` WHERE name = $1 FOR UPDATE`
+		if err := tx.QueryRow(ctx, query, b.Name).Scan(&lastKey, &progress.rows, &progress.batches, &completedAt); err != nil {
+			return fmt.Errorf("error reading checkpoint of backfill %s: %w", b.Name, err)
+		}
+		if completedAt != nil {
+			done = true
+			return nil
+		}
+
+		batch, err := b.selectBatch(ctx, tx, queries, lastKey)
+		if err != nil {
+			return err
+		}
+		if batch.Size == 0 {
+			done = true
+			query = `UPDATE ` + queries.checkpoints + ` SET completed_at = now(), updated_at = now() WHERE name = $1`
+			if _, err := tx.Exec(ctx, query, b.Name); err != nil {
+				return fmt.Errorf("error completing backfill %s: %w", b.Name, err)
+			}
+			return nil
+		}
+
+		if err := b.Batch(ctx, tx, batch.BackfillBatch); err != nil {
+			return fmt.Errorf("error in batch %d of backfill %s: %w", progress.batches+1, b.Name, err)
+		}
+		query = `UPDATE ` + queries.checkpoints + ` SET last_key = $2, rows = rows + $3, batches = batches + 1, updated_at = now()
+			WHERE name = $1 RETURNING rows, batches`
+		if err := tx.QueryRow(ctx, query, b.Name, batch.lastKey, batch.Size).Scan(&progress.rows, &progress.batches); err != nil {
+			return fmt.Errorf("error checkpointing backfill %s: %w", b.Name, err)
+		}
+		progress.lastKey = batch.lastKey
+		return nil
+	})
+	return progress, done, err
+}
+
+// selectedBatch is a BackfillBatch along with the text of its last key for the checkpoint.
+type selectedBatch struct {
+	BackfillBatch
+	lastKey string
+}
+
+// selectBatch selects the keys of the batch after lastKey, or the first batch if lastKey is nil.
+func (b Backfill) selectBatch(ctx context.Context, tx pgx.Tx, queries backfillQueries, lastKey *string) (selectedBatch, error) {
+	batchSize := b.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBackfillBatchSize
+	}
+	var rows pgx.Rows
+	var err error
+	if lastKey == nil {
+		rows, err = tx.Query(ctx, queries.first, batchSize)
+	} else {
+		rows, err = tx.Query(ctx, queries.next, batchSize, *lastKey)
+	}
+	if err != nil {
+		return selectedBatch{}, fmt.Errorf("error selecting batch of backfill %s: %w", b.Name, err)
+	}
+	defer rows.Close()
+	var batch selectedBatch
+	for rows.Next() {
+		var key any
+		if err := rows.Scan(&key, &batch.lastKey); err != nil {
+			return selectedBatch{}, fmt.Errorf("error reading batch of backfill %s: %w", b.Name, err)
+		}
+		if batch.Size == 0 {
+			batch.First = key
+		}
+		batch.Last = key
+		batch.Size++
+	}
+	if err := rows.Err(); err != nil {
+		return selectedBatch{}, fmt.Errorf("error selecting batch of backfill %s: %w", b.Name, err)
+	}
+	return batch, nil
+}
+
+// checkpointsTable returns the qualified checkpoint table of the backfill's schema.
+func (b Backfill) checkpointsTable(ctx context.Context, tx pgx.Tx) (string, error) {
+	schemaName := b.Schema
+	if len(schemaName) == 0 {
+		if tableSchema, _, qualified := strings.Cut(b.Table, "."); qualified {
+			schemaName = tableSchema
+		}
+	}
+	if len(schemaName) == 0 {
+		var currentSchema *string
+		if err := tx.QueryRow(ctx, `SELECT current_schema()`).Scan(&currentSchema); err != nil {
+			return "", fmt.Errorf("error reading current schema for backfill %s: %w", b.Name, err)
+		}
+		if currentSchema == nil {
+			return "", fmt.Errorf("backfill %s has no Schema and the search_path has no schema", b.Name)
+		}
+		schemaName = *currentSchema
+	}
+	return pgx.Identifier{schemaName, backfillsTable}.Sanitize(), nil
+}
+
+// ensureBackfillsTable creates checkpoints, the qualified checkpoint table, if it does not exist.
+func ensureBackfillsTable(ctx context.Context, tx pgx.Tx, checkpoints string) error {
+	query := `CREATE TABLE IF NOT EXISTS ` + checkpoints + ` (
+		name         text PRIMARY KEY,
+		last_key     text,
+		rows         bigint NOT NULL DEFAULT 0,
+		batches      bigint NOT NULL DEFAULT 0,
+		started_at   timestamptz NOT NULL DEFAULT now(),
+		updated_at   timestamptz NOT NULL DEFAULT now(),
+		completed_at timestamptz
+	)`
+	if _, err := tx.Exec(ctx, query); err != nil {
+		return fmt.Errorf("error creating %s table: %w", checkpoints, err)
+	}
+	return nil
+}
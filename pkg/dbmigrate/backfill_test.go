@@ -0,0 +1,190 @@
+package dbmigrate_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5"
+	"github.com/pennsieve/dbmigrate-go/pkg/config"
+	"github.com/pennsieve/dbmigrate-go/pkg/dbmigrate"
+	"github.com/pennsieve/dbmigrate-go/pkg/dbmigratetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"testing"
+	"testing/fstest"
+)
+
+// backfillMigrations create a table of 25 rows with no node ids
+var backfillMigrations = fstest.MapFS{
+	"1_create_backfill_table.up.sql":   {Data: []byte("CREATE TABLE backfill_table (id INT PRIMARY KEY, node_id TEXT); INSERT INTO backfill_table (id) SELECT generate_series(1, 25);")},
+	"1_create_backfill_table.down.sql": {Data: []byte("DROP TABLE backfill_table;")},
+}
+
+// nodeIDBackfill sets the node ids of backfill_table, recording each batch in batches
+func nodeIDBackfill(batches *[]dbmigrate.BackfillBatch) dbmigrate.Backfill {
+	return dbmigrate.Backfill{
+		Name:      "node_ids",
+		Table:     "backfill_table",
+		Key:       "id",
+		BatchSize: 10,
+		Batch: func(ctx context.Context, tx pgx.Tx, batch dbmigrate.BackfillBatch) error {
+			*batches = append(*batches, batch)
+			_, err := tx.Exec(ctx, "UPDATE backfill_table SET node_id = 'N:' || id WHERE id BETWEEN $1 AND $2", batch.First, batch.Last)
+			return err
+		},
+	}
+}
+
+func countNodeIDs(ctx context.Context, t *testing.T, verificationConn *pgx.Conn) int {
+	t.Helper()
+	var count int
+	require.NoError(t, verificationConn.QueryRow(ctx,
+		fmt.Sprintf("SELECT COUNT(node_id) FROM %s.backfill_table", schema)).Scan(&count))
+	return count
+}
+
+func TestDatabaseMigrator_Backfill(t *testing.T) {
+	ctx := context.Background()
+
+	migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+	require.NoError(t, err)
+	migrationsSource, err := iofs.New(backfillMigrations, ".")
+	require.NoError(t, err)
+	var logs bytes.Buffer
+	migrator, verificationConn := newTestMigrator(ctx, t, migrateConfig, migrationsSource,
+		dbmigrate.WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+	require.NoError(t, migrator.Up())
+
+	var batches []dbmigrate.BackfillBatch
+	backfill := nodeIDBackfill(&batches)
+	setNodeIDs := backfill.Batch
+	// the second batch fails, as if the run were interrupted
+	backfill.Batch = func(ctx context.Context, tx pgx.Tx, batch dbmigrate.BackfillBatch) error {
+		if err := setNodeIDs(ctx, tx, batch); err != nil {
+			return err
+		}
+		if len(batches) == 2 {
+			return errors.New("interrupted")
+		}
+		return nil
+	}
+	require.ErrorContains(t, migrator.Backfill(ctx, backfill), "interrupted")
+	assert.Equal(t, 10, countNodeIDs(ctx, t, verificationConn))
+
+	// running again resumes from the failed batch
+	require.NoError(t, migrator.Backfill(ctx, backfill))
+	assert.Equal(t, 25, countNodeIDs(ctx, t, verificationConn))
+	assert.Equal(t, []dbmigrate.BackfillBatch{
+		{First: int32(1), Last: int32(10), Size: 10},
+		{First: int32(11), Last: int32(20), Size: 10},
+		{First: int32(11), Last: int32(20), Size: 10},
+		{First: int32(21), Last: int32(25), Size: 5},
+	}, batches)
+	assert.Contains(t, logs.String(), "msg=\"backfill batch\" schema=test_schema backfill=node_ids rows=10 batches=1 last_key=10")
+	assert.Contains(t, logs.String(), "msg=\"backfill complete\" schema=test_schema backfill=node_ids rows=25 batches=3")
+
+	// a completed backfill does nothing
+	batches = nil
+	require.NoError(t, migrator.Backfill(ctx, backfill))
+	assert.Empty(t, batches)
+}
+
+func TestDatabaseMigrator_BackfillGoMigration(t *testing.T) {
+	ctx := context.Background()
+
+	migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+	require.NoError(t, err)
+	migrationsSource, err := iofs.New(backfillMigrations, ".")
+	require.NoError(t, err)
+	var batches []dbmigrate.BackfillBatch
+	backfill := nodeIDBackfill(&batches)
+	migrator, verificationConn := newTestMigrator(ctx, t, migrateConfig, migrationsSource,
+		dbmigrate.WithGoMigrations(dbmigrate.GoMigration{Version: 2, Identifier: "backfill_node_ids", UpNoTransaction: backfill.Up, Down: backfill.Reset}))
+
+	require.NoError(t, migrator.Up())
+	assert.Equal(t, 25, countNodeIDs(ctx, t, verificationConn))
+	assert.Len(t, batches, 3)
+
+	// after the down migration resets the checkpoint, the backfill runs again
+	require.NoError(t, migrator.Steps(-1))
+	_, err = verificationConn.Exec(ctx, fmt.Sprintf("UPDATE %s.backfill_table SET node_id = NULL", schema))
+	require.NoError(t, err)
+	require.NoError(t, migrator.Up())
+	assert.Equal(t, 25, countNodeIDs(ctx, t, verificationConn))
+	assert.Len(t, batches, 6)
+}
+
+func TestDatabaseMigrator_BackfillGoMigrationInterrupted(t *testing.T) {
+	ctx := context.Background()
+
+	migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+	require.NoError(t, err)
+	migrationsSource, err := iofs.New(backfillMigrations, ".")
+	require.NoError(t, err)
+	var batches []dbmigrate.BackfillBatch
+	backfill := nodeIDBackfill(&batches)
+	setNodeIDs := backfill.Batch
+	// the second batch fails the first time, as if the Lambda running the migration timed out
+	interrupted := false
+	backfill.Batch = func(ctx context.Context, tx pgx.Tx, batch dbmigrate.BackfillBatch) error {
+		if err := setNodeIDs(ctx, tx, batch); err != nil {
+			return err
+		}
+		if len(batches) == 2 && !interrupted {
+			interrupted = true
+			return errors.New("interrupted")
+		}
+		return nil
+	}
+	migrator, verificationConn := newTestMigrator(ctx, t, migrateConfig, migrationsSource,
+		dbmigrate.WithGoMigrations(dbmigrate.GoMigration{Version: 2, Identifier: "backfill_node_ids", UpNoTransaction: backfill.Up, Down: backfill.Reset}))
+
+	require.ErrorContains(t, migrator.Up(), "interrupted")
+	// the first batch was committed along with its checkpoint, and the schema is left dirty
+	assert.Equal(t, 10, countNodeIDs(ctx, t, verificationConn))
+	state, err := migrator.DirtyState()
+	require.NoError(t, err)
+	require.NotNil(t, state)
+	assert.Equal(t, uint(2), state.Version)
+
+	// running the migration again resumes from the checkpoint
+	require.NoError(t, migrator.Force(int(state.PreviousVersion)))
+	require.NoError(t, migrator.Up())
+	assert.Equal(t, 25, countNodeIDs(ctx, t, verificationConn))
+	assert.Equal(t, []dbmigrate.BackfillBatch{
+		{First: int32(1), Last: int32(10), Size: 10},
+		{First: int32(11), Last: int32(20), Size: 10},
+		{First: int32(11), Last: int32(20), Size: 10},
+		{First: int32(21), Last: int32(25), Size: 5},
+	}, batches)
+}
+
+func TestBackfill_RunQualifiedTable(t *testing.T) {
+	ctx := context.Background()
+
+	migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+	require.NoError(t, err)
+	migrationsSource, err := iofs.New(backfillMigrations, ".")
+	require.NoError(t, err)
+	migrator, verificationConn := newTestMigrator(ctx, t, migrateConfig, migrationsSource)
+	require.NoError(t, migrator.Up())
+
+	// the verification connection's search_path does not include the schema, so the checkpoint table
+	// must follow the schema Table is qualified by
+	backfill := dbmigrate.Backfill{
+		Name:      "node_ids",
+		Table:     schema + ".backfill_table",
+		Key:       "id",
+		BatchSize: 10,
+		Batch: func(ctx context.Context, tx pgx.Tx, batch dbmigrate.BackfillBatch) error {
+			_, err := tx.Exec(ctx, fmt.Sprintf("UPDATE %s.backfill_table SET node_id = 'N:' || id WHERE id BETWEEN $1 AND $2", schema), batch.First, batch.Last)
+			return err
+		},
+	}
+	require.NoError(t, backfill.Run(ctx, verificationConn))
+	assert.Equal(t, 25, countNodeIDs(ctx, t, verificationConn))
+	dbmigratetest.AssertTableExists(t, verificationConn, schema, "schema_migrations_backfills")
+}
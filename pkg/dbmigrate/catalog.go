@@ -0,0 +1,217 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"strings"
+)
+
+// catalogTables are the bookkeeping tables DatabaseMigrator keeps in the schema, which are left out of
+// catalog snapshots since they are not created by the migrations.
+var catalogTables = []string{migrationsTable, checksumsTable, historyTable, backfillsTable}
+
+// catalogObject is a table, column, index or other object of a schema as read from pg_catalog.
+type catalogObject struct {
+	// kind is the kind of object, such as "table" or "column"
+	kind string
+	// table is the table or view the object belongs to, such as a column's table, or empty if it belongs to none
+	table string
+	// name identifies the object among those of its kind, within its table if it has one
+	name string
+	// definition is what the object is, such as a column's type, normalized by Postgres
+	definition string
+}
+
+// qualifiedName is the name of the object qualified by its table, if it has one.
+func (o catalogObject) qualifiedName() string {
+	if len(o.table) > 0 {
+		return o.table + "." + o.name
+	}
+	return o.name
+}
+
+func (o catalogObject) key() string {
+	return o.kind + " " + o.qualifiedName()
+}
+
+// catalogSnapshot is the objects of a schema, grouped by kind and sorted by table and name within each
+// kind, except that columns are in table order.
+type catalogSnapshot []catalogObject
+
+// catalogQueries read each kind of object of the schema $1, skipping the bookkeeping tables in $2 and
+// whatever belongs to them. Each returns the table, name and definition of the objects. They are run with
+// the search_path set to the schema, so that the definitions from pg_get_*def are not qualified by the
+// schema name. NOT NULL constraints, which Postgres 18 also lists in pg_constraint, are left to the columns.
+var catalogQueries = []struct {
+	kind  string
+	query string
+}{
+	{"type", `SELECT '', t.typname,
+			CASE t.typtype
+				WHEN 'e' THEN 'enum (' || (SELECT coalesce(string_agg(quote_literal(e.enumlabel), ', ' ORDER BY e.enumsortorder), '')
+					FROM pg_enum e WHERE e.enumtypid = t.oid) || ')'
+				ELSE 'domain ' || format_type(t.typbasetype, t.typtypmod)
+					|| CASE WHEN t.typnotnull THEN ' NOT NULL' ELSE '' END
+					|| coalesce(' DEFAULT ' || t.typdefault, '')
+			END
+		FROM pg_type t JOIN pg_namespace n ON n.oid = t.typnamespace
+		WHERE n.nspname = $1 AND t.typtype IN ('e', 'd') AND NOT $2::text[] @> ARRAY[t.typname::text]
+		ORDER BY t.typname`},
+	{"sequence", `SELECT '', c.relname, format_type(s.seqtypid, NULL) || ' increment ' || s.seqincrement || ' start ' || s.seqstart
+		FROM pg_sequence s JOIN pg_class c ON c.oid = s.seqrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND NOT EXISTS (SELECT 1 FROM pg_depend d JOIN pg_class t ON t.oid = d.refobjid
+			WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype = 'a' AND $2::text[] @> ARRAY[t.relname::text])
+		ORDER BY c.relname`},
+	{"table", `SELECT '', c.relname, CASE c.relkind WHEN 'p' THEN 'partitioned table' WHEN 'f' THEN 'foreign table' ELSE 'table' END
+		FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relkind IN ('r', 'p', 'f') AND NOT $2::text[] @> ARRAY[c.relname::text]
+		ORDER BY c.relname`},
+	{"view", `SELECT '', c.relname, 'AS ' || trim(pg_get_viewdef(c.oid, true))
+		FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relkind = 'v' AND NOT $2::text[] @> ARRAY[c.relname::text]
+		ORDER BY c.relname`},
+	{"materialized view", `SELECT '', c.relname, 'AS ' || trim(pg_get_viewdef(c.oid, true))
+		FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relkind = 'm' AND NOT $2::text[] @> ARRAY[c.relname::text]
+		ORDER BY c.relname`},
+	{"column", `SELECT c.relname, a.attname,
+			format_type(a.atttypid, a.atttypmod)
+				|| CASE WHEN a.attnotnull THEN ' NOT NULL' ELSE '' END
+				|| coalesce(' DEFAULT ' || pg_get_expr(d.adbin, d.adrelid, true), '')
+		FROM pg_attribute a
+			JOIN pg_class c ON c.oid = a.attrelid
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+			LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE n.nspname = $1 AND c.relkind IN ('r', 'p', 'f', 'v', 'm') AND NOT $2::text[] @> ARRAY[c.relname::text]
+			AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY c.relname, a.attnum`},
+	{"constraint", `SELECT c.relname, con.conname, pg_get_constraintdef(con.oid, true)
+		FROM pg_constraint con JOIN pg_class c ON c.oid = con.conrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND con.contype <> 'n' AND NOT $2::text[] @> ARRAY[c.relname::text]
+		ORDER BY c.relname, con.conname`},
+	{"index", `SELECT c.relname, i.relname, pg_get_indexdef(x.indexrelid, 0, true)
+		FROM pg_index x
+			JOIN pg_class i ON i.oid = x.indexrelid
+			JOIN pg_class c ON c.oid = x.indrelid
+			JOIN pg_namespace n ON n.oid = i.relnamespace
+		WHERE n.nspname = $1 AND NOT $2::text[] @> ARRAY[c.relname::text]
+		ORDER BY c.relname, i.relname`},
+	// pg_get_functiondef always qualifies the function name, so functions are described from their parts
+	{"function", `SELECT '', p.proname || '(' || pg_get_function_identity_arguments(p.oid) || ')',
+			CASE p.prokind WHEN 'p' THEN 'procedure' ELSE 'returns ' || pg_get_function_result(p.oid) END
+				|| ' language ' || l.lanname
+				|| CASE p.provolatile WHEN 'i' THEN ' immutable' WHEN 's' THEN ' stable' ELSE '' END
+				|| ' AS ' || quote_literal(p.prosrc)
+		FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace JOIN pg_language l ON l.oid = p.prolang
+		WHERE n.nspname = $1 AND p.prokind IN ('f', 'p') AND NOT $2::text[] @> ARRAY[p.proname::text]
+			AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.classid = 'pg_proc'::regclass AND d.objid = p.oid AND d.deptype = 'e')
+		ORDER BY 2`},
+	{"trigger", `SELECT c.relname, tg.tgname, pg_get_triggerdef(tg.oid, true)
+		FROM pg_trigger tg JOIN pg_class c ON c.oid = tg.tgrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND NOT tg.tgisinternal AND NOT $2::text[] @> ARRAY[c.relname::text]
+		ORDER BY c.relname, tg.tgname`},
+}
+
+// snapshotCatalog reads the objects of the schema schemaName.
+func (m *DatabaseMigrator) snapshotCatalog(ctx context.Context, schemaName string) (catalogSnapshot, error) {
+	conn, err := m.database.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting connection to read catalog: %w", err)
+	}
+	defer conn.Close()
+
+	query := fmt.Sprintf("SET search_path TO %s", pgx.Identifier{schemaName}.Sanitize())
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		return nil, fmt.Errorf("error setting search_path to read catalog: %w", err)
+	}
+	defer m.database.resetSession(conn)
+
+	var snapshot catalogSnapshot
+	for _, catalogQuery := range catalogQueries {
+		objects, err := queryCatalogObjects(ctx, conn, catalogQuery.kind, catalogQuery.query, schemaName)
+		if err != nil {
+			return nil, err
+		}
+		snapshot = append(snapshot, objects...)
+	}
+	return snapshot, nil
+}
+
+func queryCatalogObjects(ctx context.Context, conn *sql.Conn, kind string, query string, schemaName string) ([]catalogObject, error) {
+	rows, err := conn.QueryContext(ctx, query, schemaName, catalogTables)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %ss of schema %s: %w", kind, schemaName, err)
+	}
+	var objects []catalogObject
+	for rows.Next() {
+		object := catalogObject{kind: kind}
+		if err := rows.Scan(&object.table, &object.name, &object.definition); err != nil {
+			return nil, closeOnError(fmt.Errorf("error reading %s of schema %s: %w", kind, schemaName, err), rows)
+		}
+		objects = append(objects, object)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, closeOnError(fmt.Errorf("error reading %ss of schema %s: %w", kind, schemaName, err), rows)
+	}
+	return objects, rows.Close()
+}
+
+// CatalogDifference is an object of a schema that differs between two points in time.
+type CatalogDifference struct {
+	// Kind is the kind of object, such as table, column, index, constraint, function, trigger or type.
+	Kind string `json:"kind"`
+	// Name identifies the object. Objects belonging to a table are named table.object.
+	Name string `json:"name"`
+	// Expected is the definition the object should have, or empty if it should not exist.
+	Expected string `json:"expected,omitempty"`
+	// Actual is the definition the object has, or empty if it does not exist.
+	Actual string `json:"actual,omitempty"`
+}
+
+func (d CatalogDifference) String() string {
+	switch {
+	case len(d.Expected) == 0:
+		return fmt.Sprintf("unexpected %s %s: %s", d.Kind, d.Name, d.Actual)
+	case len(d.Actual) == 0:
+		return fmt.Sprintf("missing %s %s: %s", d.Kind, d.Name, d.Expected)
+	default:
+		return fmt.Sprintf("changed %s %s: expected %s, got %s", d.Kind, d.Name, d.Expected, d.Actual)
+	}
+}
+
+// diffCatalogs returns the differences of actual from expected, in the order of expected followed by
+// the objects only in actual.
+func diffCatalogs(expected, actual catalogSnapshot) []CatalogDifference {
+	actualObjects := make(map[string]catalogObject, len(actual))
+	for _, object := range actual {
+		actualObjects[object.key()] = object
+	}
+	expectedKeys := make(map[string]bool, len(expected))
+	var differences []CatalogDifference
+	for _, object := range expected {
+		expectedKeys[object.key()] = true
+		actualObject, exists := actualObjects[object.key()]
+		if !exists {
+			differences = append(differences, CatalogDifference{Kind: object.kind, Name: object.qualifiedName(), Expected: object.definition})
+		} else if actualObject.definition != object.definition {
+			differences = append(differences, CatalogDifference{Kind: object.kind, Name: object.qualifiedName(), Expected: object.definition, Actual: actualObject.definition})
+		}
+	}
+	for _, object := range actual {
+		if !expectedKeys[object.key()] {
+			differences = append(differences, CatalogDifference{Kind: object.kind, Name: object.qualifiedName(), Actual: object.definition})
+		}
+	}
+	return differences
+}
+
+// formatDifferences returns differences one per line, indented by indent.
+func formatDifferences(differences []CatalogDifference, indent string) string {
+	lines := make([]string, len(differences))
+	for i, difference := range differences {
+		lines[i] = indent + difference.String()
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,81 @@
+package dbmigrate
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDiffCatalogs(t *testing.T) {
+	expected := catalogSnapshot{
+		{kind: "table", name: "users", definition: "table"},
+		{kind: "column", table: "users", name: "id", definition: "integer NOT NULL"},
+		{kind: "column", table: "users", name: "email", definition: "text"},
+		{kind: "index", table: "users", name: "users_email", definition: "CREATE INDEX users_email ON users USING btree (email)"},
+	}
+	actual := catalogSnapshot{
+		{kind: "table", name: "users", definition: "table"},
+		{kind: "column", table: "users", name: "id", definition: "bigint NOT NULL"},
+		{kind: "column", table: "users", name: "email", definition: "text"},
+		{kind: "column", table: "users", name: "name", definition: "text"},
+	}
+
+	assert.Empty(t, diffCatalogs(expected, expected))
+	assert.Equal(t, []CatalogDifference{
+		{Kind: "column", Name: "users.id", Expected: "integer NOT NULL", Actual: "bigint NOT NULL"},
+		{Kind: "index", Name: "users.users_email", Expected: "CREATE INDEX users_email ON users USING btree (email)"},
+		{Kind: "column", Name: "users.name", Actual: "text"},
+	}, diffCatalogs(expected, actual))
+}
+
+func TestReversibilityResult_String(t *testing.T) {
+	result := ReversibilityResult{
+		Migration: Migration{Version: 2, Identifier: "add_column"},
+		Differences: []CatalogDifference{
+			{Kind: "column", Name: "users.id", Expected: "integer NOT NULL", Actual: "bigint NOT NULL"},
+			{Kind: "index", Name: "users.users_email", Expected: "CREATE INDEX users_email ON users USING btree (email)"},
+		},
+		ReapplyDifferences: []CatalogDifference{
+			{Kind: "column", Name: "users.name", Actual: "text"},
+		},
+	}
+	assert.False(t, result.Reversible())
+	assert.Equal(t, `2_add_column: down migration does not restore the schema:
+  changed column users.id: expected integer NOT NULL, got bigint NOT NULL
+  missing index users.users_email: CREATE INDEX users_email ON users USING btree (email)
+2_add_column: up migration has a different result when applied again:
+  unexpected column users.name: text`, result.String())
+
+	assert.Equal(t, "2_add_column is reversible", ReversibilityResult{Migration: result.Migration}.String())
+	assert.Equal(t, "2_add_column has no down migration", ReversibilityResult{Migration: result.Migration, NoDown: true}.String())
+}
+
+func TestCatalogSnapshot_Dump(t *testing.T) {
+	snapshot := catalogSnapshot{
+		{kind: "type", name: "user_role", definition: "enum ('admin', 'member')"},
+		{kind: "table", name: "users", definition: "table"},
+		{kind: "view", name: "admins", definition: "AS SELECT id\n   FROM users\n  WHERE role = 'admin'::user_role;"},
+		{kind: "column", table: "users", name: "id", definition: "integer NOT NULL"},
+		{kind: "column", table: "users", name: "role", definition: "user_role"},
+		{kind: "column", table: "admins", name: "id", definition: "integer"},
+		{kind: "constraint", table: "users", name: "users_pkey", definition: "PRIMARY KEY (id)"},
+		{kind: "function", name: "touch()", definition: "returns trigger language plpgsql AS '\nBEGIN\n    RETURN NEW;\nEND\n'"},
+	}
+	assert.Equal(t, `type user_role: enum ('admin', 'member')
+
+table users
+  column id: integer NOT NULL
+  column role: user_role
+  constraint users_pkey: PRIMARY KEY (id)
+
+view admins: AS SELECT id
+       FROM users
+      WHERE role = 'admin'::user_role;
+  column id: integer
+
+function touch(): returns trigger language plpgsql AS '
+    BEGIN
+        RETURN NEW;
+    END
+    '
+`, snapshot.dump())
+}
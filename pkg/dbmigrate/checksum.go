@@ -0,0 +1,187 @@
+package dbmigrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/pennsieve/dbmigrate-go/pkg/config"
+	"os"
+	"strings"
+)
+
+// checksumsTable holds the checksum of each applied up migration.
+const checksumsTable = "schema_migrations_checksums"
+
+// ErrChecksumsNotEnabled is returned by Verify if the DatabaseMigrator was not configured to record checksums.
+var ErrChecksumsNotEnabled = errors.New("migration checksums are not enabled")
+
+// ChecksumMismatch is an applied migration whose file no longer matches the checksum recorded when it was applied.
+type ChecksumMismatch struct {
+	Migration
+	// Recorded is the checksum recorded when the migration was applied.
+	Recorded string
+	// Current is the checksum of the migration file now served by the source.Driver. Empty if the
+	// source no longer has the migration.
+	Current string
+}
+
+func (c ChecksumMismatch) String() string {
+	if len(c.Current) == 0 {
+		return fmt.Sprintf("%d_%s (missing)", c.Version, c.Identifier)
+	}
+	return fmt.Sprintf("%d_%s (changed)", c.Version, c.Identifier)
+}
+
+// ChecksumMismatchError is returned by Verify, and by Up in config.ChecksumFail mode, if any applied
+// migration files have changed since they were applied.
+type ChecksumMismatchError struct {
+	Mismatches []ChecksumMismatch
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	names := make([]string, 0, len(e.Mismatches))
+	for _, mismatch := range e.Mismatches {
+		names = append(names, mismatch.String())
+	}
+	return fmt.Sprintf("applied migrations do not match their recorded checksums: %s", strings.Join(names, ", "))
+}
+
+// Verify compares the checksums recorded when migrations were applied with the up migrations now
+// served by the source.Driver. If any differ, or are no longer in the source, it returns a
+// *ChecksumMismatchError. Migrations applied before checksums were enabled are not checked.
+// It returns ErrChecksumsNotEnabled if the checksum mode is config.ChecksumOff.
+func (m *DatabaseMigrator) Verify(ctx context.Context) error {
+	if m.database.checksums == nil {
+		return ErrChecksumsNotEnabled
+	}
+	recorded, err := m.database.checksums.recorded(ctx)
+	if err != nil {
+		return err
+	}
+	var mismatches []ChecksumMismatch
+	for _, r := range recorded {
+		body, identifier, err := readMigration(m.source, r.Version, DirectionUp)
+		if errors.Is(err, os.ErrNotExist) {
+			mismatches = append(mismatches, ChecksumMismatch{Migration: r.Migration, Recorded: r.Checksum})
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if current := checksum(body); current != r.Checksum {
+			mismatches = append(mismatches, ChecksumMismatch{
+				Migration: Migration{Version: r.Version, Identifier: identifier},
+				Recorded:  r.Checksum,
+				Current:   current,
+			})
+		}
+	}
+	if len(mismatches) > 0 {
+		return &ChecksumMismatchError{Mismatches: mismatches}
+	}
+	return nil
+}
+
+// verifyBeforeUp runs Verify according to the checksum mode, either failing or logging a warning on a mismatch.
+func (m *DatabaseMigrator) verifyBeforeUp(ctx context.Context) error {
+	if m.database.checksums == nil {
+		return nil
+	}
+	err := m.Verify(ctx)
+	var mismatchErr *ChecksumMismatchError
+	if m.database.checksums.mode == config.ChecksumWarn && errors.As(err, &mismatchErr) {
+		m.wrapped.Log.Printf("warning: %v", err)
+		return nil
+	}
+	return err
+}
+
+// checksum returns the hex encoded SHA-256 of a migration body.
+func checksum(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// recordedChecksum is a row of the checksums table.
+type recordedChecksum struct {
+	Migration
+	Checksum string
+}
+
+// checksums writes and reads the checksums table of a schema.
+type checksums struct {
+	conn       *sql.Conn
+	schemaName string
+	mode       config.ChecksumMode
+}
+
+func (c *checksums) qualifiedTable() string {
+	return pgx.Identifier{c.schemaName, checksumsTable}.Sanitize()
+}
+
+// ensureTable creates the checksums table if it does not already exist. As with the version table,
+// the caller should hold the migration lock.
+func (c *checksums) ensureTable(ctx context.Context) error {
+	query := `CREATE TABLE IF NOT EXISTS ` + c.qualifiedTable() + ` (
+		version bigint not null primary key,
+		identifier text not null,
+		checksum text not null,
+		applied_at timestamptz not null default now()
+	)`
+	if _, err := c.conn.ExecContext(ctx, query); err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return nil
+}
+
+// record stores the checksum of a successful up migration, or removes it after a down migration.
+// A migration golang-migrate ran without a body has no file, so nothing is stored for it.
+func (c *checksums) record(ctx context.Context, e execer, event MigrationEvent, migrationChecksum string) error {
+	var query string
+	var args []any
+	switch {
+	case event.Direction == DirectionDown:
+		query = `DELETE FROM ` + c.qualifiedTable() + ` WHERE version = $1`
+		args = []any{int64(event.Version)}
+	case len(migrationChecksum) > 0:
+		query = `INSERT INTO ` + c.qualifiedTable() + ` (version, identifier, checksum) VALUES ($1, $2, $3)
+			ON CONFLICT (version) DO UPDATE SET identifier = EXCLUDED.identifier, checksum = EXCLUDED.checksum, applied_at = now()`
+		args = []any{int64(event.Version), event.Identifier, migrationChecksum}
+	default:
+		return nil
+	}
+	if _, err := e.ExecContext(ctx, query, args...); err != nil {
+		return &database.Error{OrigErr: err, Err: "error recording migration checksum", Query: []byte(query)}
+	}
+	return nil
+}
+
+func (c *checksums) recorded(ctx context.Context) ([]recordedChecksum, error) {
+	query := `SELECT version, identifier, checksum FROM ` + c.qualifiedTable() + ` ORDER BY version`
+	rows, err := c.conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	var recorded []recordedChecksum
+	for rows.Next() {
+		var r recordedChecksum
+		var version int64
+		if err := rows.Scan(&version, &r.Identifier, &r.Checksum); err != nil {
+			return nil, closeOnError(err, rows)
+		}
+		r.Version = uint(version)
+		recorded = append(recorded, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, closeOnError(&database.Error{OrigErr: err, Query: []byte(query)}, rows)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	return recorded, nil
+}
@@ -0,0 +1,116 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pennsieve/dbmigrate-go/pkg/config"
+	"net"
+	"time"
+)
+
+// ConnectErrorKind classifies why connecting to the database failed.
+type ConnectErrorKind string
+
+const (
+	// ConnectErrorAuthentication means the server rejected the credentials.
+	ConnectErrorAuthentication ConnectErrorKind = "authentication failed"
+	// ConnectErrorDatabaseMissing means the configured database does not exist.
+	ConnectErrorDatabaseMissing ConnectErrorKind = "database does not exist"
+	// ConnectErrorNetwork means the server could not be reached.
+	ConnectErrorNetwork ConnectErrorKind = "network unreachable"
+	// ConnectErrorNotReady means the server was reached but is not accepting connections yet.
+	ConnectErrorNotReady ConnectErrorKind = "database not ready"
+	// ConnectErrorTimeout means the overall connect deadline passed.
+	ConnectErrorTimeout ConnectErrorKind = "timed out"
+	// ConnectErrorOther is any other failure, for example a TLS error.
+	ConnectErrorOther ConnectErrorKind = "other"
+)
+
+// ConnectError is returned by the DatabaseMigrator constructors when the database cannot be connected to.
+type ConnectError struct {
+	Kind     ConnectErrorKind
+	Attempts int
+	Err      error
+}
+
+func (e *ConnectError) Error() string {
+	return fmt.Sprintf("error connecting to database after %d attempt(s): %s: %v", e.Attempts, e.Kind, e.Err)
+}
+
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
+// retryable reports whether another attempt might succeed.
+func (k ConnectErrorKind) retryable() bool {
+	return k == ConnectErrorNetwork || k == ConnectErrorNotReady
+}
+
+// connect pings db until it succeeds, retrying network and not-ready failures with exponential backoff
+// as configured by retryConfig. Zero backoffs, as in a ConnectRetryConfig built by hand, are the config
+// defaults. sql.Open never connects, so without this the first connection error would only surface when
+// the schema is created.
+func connect(ctx context.Context, db *sql.DB, retryConfig config.ConnectRetryConfig, logger *logger) error {
+	if retryConfig.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, retryConfig.Timeout)
+		defer cancel()
+	}
+	maxAttempts := max(retryConfig.MaxAttempts, 1)
+	backoff := retryConfig.InitialBackoff
+	if backoff <= 0 {
+		backoff = config.DefaultConnectInitialBackoff
+	}
+	maxBackoff := retryConfig.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = config.DefaultConnectMaxBackoff
+	}
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			if attempt > 1 {
+				logger.Printf("connected to database on attempt %d of %d", attempt, maxAttempts)
+			}
+			return nil
+		}
+		kind := classifyConnectError(err)
+		if !kind.retryable() || attempt == maxAttempts {
+			logger.Printf("error: connecting to database: attempt %d of %d failed, giving up (%s): %v", attempt, maxAttempts, kind, err)
+			return &ConnectError{Kind: kind, Attempts: attempt, Err: err}
+		}
+		logger.Printf("warning: connecting to database: attempt %d of %d failed (%s): %v; retrying in %v", attempt, maxAttempts, kind, err, backoff)
+		select {
+		case <-ctx.Done():
+			return &ConnectError{Kind: ConnectErrorTimeout, Attempts: attempt, Err: errors.Join(ctx.Err(), err)}
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func classifyConnectError(err error) ConnectErrorKind {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case pgerrcode.InvalidPassword, pgerrcode.InvalidAuthorizationSpecification:
+			return ConnectErrorAuthentication
+		case pgerrcode.InvalidCatalogName:
+			return ConnectErrorDatabaseMissing
+		case pgerrcode.CannotConnectNow, pgerrcode.TooManyConnections:
+			return ConnectErrorNotReady
+		}
+		return ConnectErrorOther
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return ConnectErrorTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ConnectErrorNetwork
+	}
+	return ConnectErrorOther
+}
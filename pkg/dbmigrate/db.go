@@ -0,0 +1,53 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/rds/auth"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgconn/ctxwatch"
+	"github.com/jackc/pgx/v5/stdlib"
+	"time"
+)
+
+// cancelRequestDeadlineDelay is how long a statement whose context is done has to respond to
+// the cancel request sent to the server before the connection is closed.
+const cancelRequestDeadlineDelay = 10 * time.Second
+
+// openDB returns a *sql.DB for the given datasource name. Unlike the pgx defaults, a statement whose
+// context is done is cancelled on the server rather than only abandoned by the client.
+func openDB(datasourceName string, opts ...stdlib.OptionOpenDB) (*sql.DB, error) {
+	connConfig, err := pgx.ParseConfig(datasourceName)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing database connection config: %w", err)
+	}
+	connConfig.BuildContextWatcherHandler = func(pgConn *pgconn.PgConn) ctxwatch.Handler {
+		return &pgconn.CancelRequestContextWatcherHandler{
+			Conn:          pgConn,
+			DeadlineDelay: cancelRequestDeadlineDelay,
+		}
+	}
+	return stdlib.OpenDB(*connConfig, opts...), nil
+}
+
+// rdsAuthTokenBeforeConnect returns a pgx BeforeConnect function that sets a newly built RDS IAM
+// auth token as the password of each new connection.
+func rdsAuthTokenBeforeConnect(awsConfig aws.Config) func(context.Context, *pgx.ConnConfig) error {
+	return func(ctx context.Context, connConfig *pgx.ConnConfig) error {
+		authenticationToken, err := auth.BuildAuthToken(
+			ctx,
+			fmt.Sprintf("%s:%d", connConfig.Host, connConfig.Port),
+			awsConfig.Region,
+			connConfig.User,
+			awsConfig.Credentials,
+		)
+		if err != nil {
+			return fmt.Errorf("error building auth token for Migrator: %w", err)
+		}
+		connConfig.Password = authenticationToken
+		return nil
+	}
+}
@@ -0,0 +1,154 @@
+package dbmigrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/pennsieve/dbmigrate-go/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+func TestRDSAuthTokenBeforeConnect(t *testing.T) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var retrieveCount int
+	var passwords []string
+	fakeCredentials := aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		retrieveCount++
+		return aws.Credentials{
+			AccessKeyID:     "TestAWSKey",
+			SecretAccessKey: "TestAWSSecret",
+			Source:          "fake",
+		}, nil
+	})
+	beforeConnect := rdsAuthTokenBeforeConnect(aws.Config{Region: "us-east-1", Credentials: fakeCredentials})
+
+	// nothing is listening, so every connection attempt fails, but only after a token has been built for it
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+	require.NoError(t, listener.Close())
+
+	db, err := openDB(
+		(&url.URL{Scheme: "postgres", User: url.User("migrator"), Host: net.JoinHostPort(host, port), Path: "postgres"}).String(),
+		stdlib.OptionBeforeConnect(func(ctx context.Context, connConfig *pgx.ConnConfig) error {
+			if err := beforeConnect(ctx, connConfig); err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			passwords = append(passwords, connConfig.Password)
+			return nil
+		}),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, db.Close())
+	})
+
+	connectionAttempts := 3
+	for i := 0; i < connectionAttempts; i++ {
+		assert.Error(t, db.PingContext(ctx))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, connectionAttempts, retrieveCount)
+	require.Len(t, passwords, connectionAttempts)
+	for _, password := range passwords {
+		assert.Contains(t, password, net.JoinHostPort(host, port))
+		assert.Contains(t, password, "Action=connect")
+		assert.Contains(t, password, "DBUser=migrator")
+		assert.Contains(t, password, "X-Amz-Signature=")
+	}
+}
+
+func TestDatasourceName(t *testing.T) {
+	password := "p@ss/word"
+	pgConfig := config.PostgresDBConfig{
+		Host:     "db.example.com",
+		Port:     5433,
+		User:     "migrator",
+		Password: &password,
+		Database: "postgres",
+		Schema:   "test_schema",
+	}
+
+	t.Run("no TLS settings", func(t *testing.T) {
+		connConfig, err := pgx.ParseConfig(datasourceName(pgConfig, password))
+		require.NoError(t, err)
+		assert.Equal(t, "db.example.com", connConfig.Host)
+		assert.Equal(t, uint16(5433), connConfig.Port)
+		assert.Equal(t, "migrator", connConfig.User)
+		assert.Equal(t, password, connConfig.Password)
+		assert.Equal(t, "postgres", connConfig.Database)
+		assert.Equal(t, "test_schema", connConfig.RuntimeParams["search_path"])
+	})
+
+	t.Run("sslmode disable", func(t *testing.T) {
+		disabled := pgConfig
+		disabled.SSLMode = "disable"
+		connConfig, err := pgx.ParseConfig(datasourceName(disabled, password))
+		require.NoError(t, err)
+		assert.Nil(t, connConfig.TLSConfig)
+		assert.Empty(t, connConfig.Fallbacks)
+	})
+
+	t.Run("sslmode verify-full", func(t *testing.T) {
+		verifyFull := pgConfig
+		verifyFull.SSLMode = rdsDefaultSSLMode
+		connConfig, err := pgx.ParseConfig(datasourceName(verifyFull, password))
+		require.NoError(t, err)
+		require.NotNil(t, connConfig.TLSConfig)
+		assert.False(t, connConfig.TLSConfig.InsecureSkipVerify)
+		assert.Equal(t, "db.example.com", connConfig.TLSConfig.ServerName)
+		// no plaintext fallback
+		assert.Empty(t, connConfig.Fallbacks)
+	})
+
+	t.Run("missing root cert", func(t *testing.T) {
+		withRootCert := pgConfig
+		withRootCert.SSLMode = rdsDefaultSSLMode
+		withRootCert.SSLRootCert = filepath.Join(t.TempDir(), "missing.pem")
+		_, err := pgx.ParseConfig(datasourceName(withRootCert, password))
+		assert.ErrorContains(t, err, "missing.pem")
+	})
+}
+
+func TestClassifyConnectError(t *testing.T) {
+	tests := []struct {
+		scenario string
+		err      error
+		expected ConnectErrorKind
+	}{
+		{"invalid password", &pgconn.PgError{Code: pgerrcode.InvalidPassword}, ConnectErrorAuthentication},
+		{"no pg_hba entry", &pgconn.PgError{Code: pgerrcode.InvalidAuthorizationSpecification}, ConnectErrorAuthentication},
+		{"missing database", &pgconn.PgError{Code: pgerrcode.InvalidCatalogName}, ConnectErrorDatabaseMissing},
+		{"starting up", &pgconn.PgError{Code: pgerrcode.CannotConnectNow}, ConnectErrorNotReady},
+		{"wrapped network error", fmt.Errorf("ping: %w", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}), ConnectErrorNetwork},
+		{"dns error", &net.DNSError{Err: "no such host", Name: "db.invalid", IsNotFound: true}, ConnectErrorNetwork},
+		{"deadline", fmt.Errorf("ping: %w", context.DeadlineExceeded), ConnectErrorTimeout},
+		{"other", errors.New("tls: failed to verify certificate"), ConnectErrorOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			assert.Equal(t, tt.expected, classifyConnectError(tt.err))
+		})
+	}
+}
@@ -0,0 +1,538 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pennsieve/dbmigrate-go/pkg/config"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"strings"
+	"time"
+)
+
+// migrationsTable is golang-migrate's version table. The table layout and the advisory lock id are the
+// same as golang-migrate's pgx driver uses, so the two can be used against the same schema.
+const migrationsTable = "schema_migrations"
+
+// migrationDriver is the golang-migrate database.Driver for Postgres used by DatabaseMigrator.
+// Locking and version bookkeeping use a dedicated connection, while migration bodies are run on
+// a connection from the pool using the context of the current run and the configured timeouts.
+type migrationDriver struct {
+	db *sql.DB
+	// conn is used for locking, since advisory locks belong to a session, and for the version table
+	conn         *sql.Conn
+	closeDB      bool
+	databaseName string
+	schemaName   string
+	isLocked     bool
+
+	statementTimeout time.Duration
+	lockTimeout      time.Duration
+	// ctx is the context of the current run, if any
+	ctx context.Context
+
+	source    source.Driver
+	hooks     hookList
+	telemetry *telemetry
+	// history is nil unless the audit history table is enabled
+	history *history
+	// checksums is nil if the checksum mode is off
+	checksums *checksums
+	// goMigrations are the Go migrations served by source, by version
+	goMigrations map[uint]GoMigration
+	// step is the migration currently being run, if any
+	step *migrationStep
+}
+
+// migrationStep is a migration golang-migrate is running, from when it marks the target
+// version dirty until it marks it clean.
+type migrationStep struct {
+	targetVersion int
+	// previousVersion is the version before the migration, which a rolled back migration restores
+	previousVersion int
+	// previousDirty is true if previousVersion was dirty, as it is when Recover rolls back a failed migration
+	previousDirty bool
+	event         MigrationEvent
+	started       time.Time
+	// ctx is the run context with the migration's span
+	ctx  context.Context
+	span trace.Span
+	// checksum is the checksum of the migration body, if golang-migrate ran one
+	checksum string
+	// rolledBack is true if the migration ran in a transaction that was rolled back
+	rolledBack bool
+}
+
+// newMigrationDriver returns a migrationDriver for schemaName, creating the version table if needed.
+// If closeDB is false, Close will leave db open. migrationsSource is only used to identify migrations to hooks
+// and telemetry.
+func newMigrationDriver(ctx context.Context, db *sql.DB, closeDB bool, schemaName string, migrationsSource source.Driver, opts *options) (*migrationDriver, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting connection for migrations: %w", err)
+	}
+	d := &migrationDriver{
+		db:               db,
+		conn:             conn,
+		closeDB:          closeDB,
+		schemaName:       schemaName,
+		statementTimeout: opts.migration.StatementTimeout,
+		lockTimeout:      opts.migration.LockTimeout,
+		source:           migrationsSource,
+		hooks:            opts.hooks,
+	}
+	if s, isGo := migrationsSource.(*goSource); isGo {
+		d.goMigrations = s.migrations
+	}
+	if opts.migration.History {
+		d.history = &history{conn: conn, schemaName: schemaName, actor: opts.migration.Actor}
+	}
+	if mode := opts.migration.ChecksumMode; mode != "" && mode != config.ChecksumOff {
+		d.checksums = &checksums{conn: conn, schemaName: schemaName, mode: mode}
+	}
+	query := `SELECT CURRENT_DATABASE()`
+	if err := conn.QueryRowContext(ctx, query).Scan(&d.databaseName); err != nil {
+		return nil, closeOnError(&database.Error{OrigErr: err, Query: []byte(query)}, conn)
+	}
+	if d.telemetry, err = newTelemetry(opts.tracerProvider, opts.meterProvider, schemaName, d.databaseName); err != nil {
+		return nil, closeOnError(err, conn)
+	}
+	if err := d.ensureVersionTable(ctx); err != nil {
+		return nil, closeOnError(err, conn)
+	}
+	return d, nil
+}
+
+func (d *migrationDriver) setContext(ctx context.Context) {
+	d.ctx = ctx
+}
+
+// runContext returns the context of the current run, or context.Background() outside a run.
+func (d *migrationDriver) runContext() context.Context {
+	if d.ctx == nil {
+		return context.Background()
+	}
+	return d.ctx
+}
+
+// execContext returns the context migration statements are run with. Cancelling the run context only
+// stops the run after the current migration, so the returned context is not cancelled with it, but
+// a deadline on the run context still cancels the in-flight statement.
+func (d *migrationDriver) execContext() (context.Context, context.CancelFunc) {
+	if d.ctx == nil {
+		return context.Background(), func() {}
+	}
+	ctx := context.WithoutCancel(d.ctx)
+	if deadline, hasDeadline := d.ctx.Deadline(); hasDeadline {
+		return context.WithDeadline(ctx, deadline)
+	}
+	return ctx, func() {}
+}
+
+func (d *migrationDriver) qualifiedMigrationsTable() string {
+	return pgx.Identifier{d.schemaName, migrationsTable}.Sanitize()
+}
+
+// Open is part of database.Driver, but migrationDriver is only created from an existing *sql.DB.
+func (d *migrationDriver) Open(string) (database.Driver, error) {
+	return nil, errors.New("migrationDriver does not support Open")
+}
+
+func (d *migrationDriver) Close() error {
+	connErr := d.conn.Close()
+	if !d.closeDB {
+		return connErr
+	}
+	dbErr := d.db.Close()
+	if connErr != nil || dbErr != nil {
+		return fmt.Errorf("conn: %v, db: %v", connErr, dbErr)
+	}
+	return nil
+}
+
+func (d *migrationDriver) advisoryLockID() (string, error) {
+	return database.GenerateAdvisoryLockId(d.databaseName, d.schemaName, migrationsTable)
+}
+
+func (d *migrationDriver) Lock() error {
+	if d.isLocked {
+		return database.ErrLocked
+	}
+	lockID, err := d.advisoryLockID()
+	if err != nil {
+		return err
+	}
+	// This will wait indefinitely until the lock can be acquired. golang-migrate applies its own timeout.
+	query := `SELECT pg_advisory_lock($1)`
+	started := time.Now()
+	if _, err := d.conn.ExecContext(context.Background(), query, lockID); err != nil {
+		return &database.Error{OrigErr: err, Err: "try lock failed", Query: []byte(query)}
+	}
+	d.telemetry.recordLockWait(d.runContext(), time.Since(started))
+	d.isLocked = true
+	return nil
+}
+
+func (d *migrationDriver) Unlock() error {
+	if !d.isLocked {
+		return database.ErrNotLocked
+	}
+	lockID, err := d.advisoryLockID()
+	if err != nil {
+		return err
+	}
+	query := `SELECT pg_advisory_unlock($1)`
+	if _, err := d.conn.ExecContext(context.Background(), query, lockID); err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	d.isLocked = false
+	return nil
+}
+
+func (d *migrationDriver) Run(migration io.Reader) error {
+	if err := d.run(migration); err != nil {
+		return d.failStep(err)
+	}
+	return nil
+}
+
+func (d *migrationDriver) run(migration io.Reader) error {
+	body, err := io.ReadAll(migration)
+	if err != nil {
+		return fmt.Errorf("error reading migration: %w", err)
+	}
+	if d.step != nil {
+		d.step.checksum = checksum(body)
+	}
+	query := string(body)
+	if strings.TrimSpace(query) == "" {
+		return nil
+	}
+	mode, err := headerTransactionMode(query)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := d.execContext()
+	defer cancel()
+
+	conn, err := d.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting connection for migration: %w", err)
+	}
+	defer conn.Close()
+
+	if err := d.setSession(ctx, conn); err != nil {
+		return err
+	}
+	defer d.resetSession(conn)
+
+	if migration, isGo := d.goMigration(); isGo {
+		direction := d.step.event.Direction
+		if fn := migration.connFunction(direction); fn != nil {
+			return execGoMigrationNoTransaction(ctx, conn, fn)
+		}
+		if err := execGoMigration(ctx, conn, migration.function(direction)); err != nil {
+			d.step.rolledBack = true
+			return err
+		}
+		return nil
+	}
+	switch mode {
+	case transactionWrap:
+		if err := execInTransaction(ctx, conn, query); err != nil {
+			if d.step != nil {
+				d.step.rolledBack = true
+			}
+			return err
+		}
+		return nil
+	case transactionNone:
+		return execStatements(ctx, conn, query)
+	}
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		return migrationError(query, err)
+	}
+	return nil
+}
+
+// goMigration returns the Go migration being run, if it is one.
+func (d *migrationDriver) goMigration() (GoMigration, bool) {
+	if d.step == nil {
+		return GoMigration{}, false
+	}
+	migration, isGo := d.goMigrations[d.step.event.Version]
+	return migration, isGo
+}
+
+// setSession points conn at the target schema and applies the configured timeouts.
+func (d *migrationDriver) setSession(ctx context.Context, conn *sql.Conn) error {
+	settings := []string{fmt.Sprintf("SET search_path TO %s", pgx.Identifier{d.schemaName}.Sanitize())}
+	if d.statementTimeout > 0 {
+		settings = append(settings, fmt.Sprintf("SET statement_timeout = %d", d.statementTimeout.Milliseconds()))
+	}
+	if d.lockTimeout > 0 {
+		settings = append(settings, fmt.Sprintf("SET lock_timeout = %d", d.lockTimeout.Milliseconds()))
+	}
+	query := strings.Join(settings, "; ")
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		return &database.Error{OrigErr: err, Err: "error setting migration session", Query: []byte(query)}
+	}
+	return nil
+}
+
+// resetSession restores the session defaults before conn goes back to the pool, which may not be ours.
+// Failure here is not a migration failure, and a connection broken by a cancelled statement is
+// discarded by the pool anyway.
+func (d *migrationDriver) resetSession(conn *sql.Conn) {
+	_, _ = conn.ExecContext(context.Background(), "RESET search_path; RESET statement_timeout; RESET lock_timeout")
+}
+
+// SetVersion is called by golang-migrate with dirty set to true before it runs each migration, and with
+// dirty set to false once the migration has succeeded, which is when the migration hooks are called.
+func (d *migrationDriver) SetVersion(version int, dirty bool) error {
+	if dirty {
+		step, err := d.newStep(version)
+		if err != nil {
+			return err
+		}
+		d.startStep(step)
+		if err := d.setVersion(version, true, nil); err != nil {
+			return d.failStep(err)
+		}
+		return nil
+	}
+	step := d.step
+	if step == nil || step.targetVersion != version {
+		if err := d.setVersion(version, false, nil); err != nil {
+			return d.failStep(err)
+		}
+		return nil
+	}
+	event := step.event
+	event.Elapsed = time.Since(step.started)
+	// the history row and checksum are written in the same transaction as the clean version
+	record := func(tx *sql.Tx) error {
+		if d.history != nil {
+			if err := d.history.record(context.Background(), tx, event, step.started, step.checksum); err != nil {
+				return err
+			}
+		}
+		if d.checksums != nil {
+			return d.checksums.record(context.Background(), tx, event, step.checksum)
+		}
+		return nil
+	}
+	if err := d.setVersion(version, false, record); err != nil {
+		return d.failStep(err)
+	}
+	d.step = nil
+	d.telemetry.endMigration(step.ctx, step.span, event)
+	d.hooks.afterMigration(step.ctx, event)
+	return nil
+}
+
+// startStep makes step the migration being run, calling the BeforeMigration hooks.
+func (d *migrationDriver) startStep(step *migrationStep) {
+	step.ctx, step.span = d.telemetry.startMigration(d.runContext(), step.event)
+	d.hooks.beforeMigration(step.ctx, step.event)
+	step.started = time.Now()
+	d.step = step
+}
+
+// newStep describes the migration golang-migrate is about to run to take the schema from its
+// current version to targetVersion.
+func (d *migrationDriver) newStep(targetVersion int) (*migrationStep, error) {
+	currentVersion, _, err := d.Version()
+	if err != nil {
+		return nil, err
+	}
+	event := MigrationEvent{Direction: DirectionUp}
+	if targetVersion > currentVersion {
+		event.Version = uint(targetVersion)
+	} else {
+		// a down migration is identified by the version it removes
+		event.Direction = DirectionDown
+		event.Version = uint(currentVersion)
+	}
+	identifier, err := directionIdentifier(d.source, event.Version, event.Direction)
+	if err != nil {
+		return nil, err
+	}
+	event.Identifier = identifier
+	return &migrationStep{targetVersion: targetVersion, previousVersion: currentVersion, event: event}, nil
+}
+
+// failStep calls the OnError hooks if a migration is being run, and returns err. If the migration was
+// rolled back, the version is restored to the previous version.
+func (d *migrationDriver) failStep(err error) error {
+	if step := d.step; step != nil {
+		event := step.event
+		event.Elapsed = time.Since(step.started)
+		event.Err = err
+		d.step = nil
+		if step.rolledBack {
+			if restoreErr := d.setVersion(step.previousVersion, step.previousDirty, nil); restoreErr != nil {
+				err = errors.Join(err, restoreErr)
+			}
+		}
+		if d.history != nil {
+			if recordErr := d.history.record(context.Background(), d.conn, event, step.started, step.checksum); recordErr != nil {
+				err = errors.Join(err, recordErr)
+			}
+		}
+		d.telemetry.endMigration(step.ctx, step.span, event)
+		d.hooks.onError(step.ctx, event)
+	}
+	return err
+}
+
+// setVersion records version in the version table. If record is not nil it is called in the same transaction.
+func (d *migrationDriver) setVersion(version int, dirty bool, record func(tx *sql.Tx) error) error {
+	tx, err := d.conn.BeginTx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction start failed"}
+	}
+
+	query := `TRUNCATE ` + d.qualifiedMigrationsTable()
+	if _, err := tx.Exec(query); err != nil {
+		return rollbackOnError(tx, &database.Error{OrigErr: err, Query: []byte(query)})
+	}
+
+	// As golang-migrate's driver does, also write the nil version if it is dirty so that a failed
+	// down migration of the first migration is recorded.
+	if version >= 0 || (version == database.NilVersion && dirty) {
+		query = `INSERT INTO ` + d.qualifiedMigrationsTable() + ` (version, dirty) VALUES ($1, $2)`
+		if _, err := tx.Exec(query, version, dirty); err != nil {
+			return rollbackOnError(tx, &database.Error{OrigErr: err, Query: []byte(query)})
+		}
+	}
+
+	if record != nil {
+		if err := record(tx); err != nil {
+			return rollbackOnError(tx, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction commit failed"}
+	}
+	return nil
+}
+
+func (d *migrationDriver) Version() (version int, dirty bool, err error) {
+	return d.versionContext(context.Background())
+}
+
+// versionContext is Version with a context.
+func (d *migrationDriver) versionContext(ctx context.Context) (version int, dirty bool, err error) {
+	query := `SELECT version, dirty FROM ` + d.qualifiedMigrationsTable() + ` LIMIT 1`
+	err = d.conn.QueryRowContext(ctx, query).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.NilVersion, false, nil
+	}
+	if err != nil {
+		return 0, false, &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return version, dirty, nil
+}
+
+// Drop drops all tables in the target schema, whatever the search_path of the connection.
+func (d *migrationDriver) Drop() error {
+	query := `SELECT table_name FROM information_schema.tables WHERE table_schema = $1 AND table_type = 'BASE TABLE'`
+	rows, err := d.conn.QueryContext(context.Background(), query, d.schemaName)
+	if err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	var tableNames []string
+	for rows.Next() {
+		var tableName string
+		if err := rows.Scan(&tableName); err != nil {
+			return closeOnError(err, rows)
+		}
+		tableNames = append(tableNames, tableName)
+	}
+	if err := rows.Err(); err != nil {
+		return closeOnError(&database.Error{OrigErr: err, Query: []byte(query)}, rows)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	for _, tableName := range tableNames {
+		query = `DROP TABLE IF EXISTS ` + pgx.Identifier{d.schemaName, tableName}.Sanitize() + ` CASCADE`
+		if _, err := d.conn.ExecContext(context.Background(), query); err != nil {
+			return &database.Error{OrigErr: err, Query: []byte(query)}
+		}
+	}
+	return nil
+}
+
+// ensureVersionTable creates the version table, and the history and checksums tables if enabled, if they do not already
+// exist. Checking first allows users without CREATE permission to still read the version.
+func (d *migrationDriver) ensureVersionTable(ctx context.Context) (err error) {
+	if err := d.Lock(); err != nil {
+		return err
+	}
+	defer func() {
+		if unlockErr := d.Unlock(); unlockErr != nil {
+			err = errors.Join(err, unlockErr)
+		}
+	}()
+
+	query := `SELECT COUNT(1) FROM information_schema.tables WHERE table_schema = $1 AND table_name = $2`
+	var count int
+	if err := d.conn.QueryRowContext(ctx, query, d.schemaName, migrationsTable).Scan(&count); err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	if count == 0 {
+		query = `CREATE TABLE IF NOT EXISTS ` + d.qualifiedMigrationsTable() + ` (version bigint not null primary key, dirty boolean not null)`
+		if _, err := d.conn.ExecContext(ctx, query); err != nil {
+			return &database.Error{OrigErr: err, Query: []byte(query)}
+		}
+	}
+	if d.history != nil {
+		if err := d.history.ensureTable(ctx); err != nil {
+			return err
+		}
+	}
+	if d.checksums != nil {
+		return d.checksums.ensureTable(ctx)
+	}
+	return nil
+}
+
+func rollbackOnError(tx *sql.Tx, originalErr error) error {
+	if rollbackErr := tx.Rollback(); rollbackErr != nil {
+		return fmt.Errorf("%w; in addition an error occured when rolling back: %v", originalErr, rollbackErr)
+	}
+	return originalErr
+}
+
+// migrationError converts an error from running a migration into the database.Error that the
+// golang-migrate pgx driver would have returned, with the line of the failing statement where known.
+func migrationError(query string, err error) database.Error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		message := fmt.Sprintf("migration failed: %s", pgErr.Message)
+		if pgErr.Detail != "" {
+			message = fmt.Sprintf("%s, %s", message, pgErr.Detail)
+		}
+		return database.Error{OrigErr: err, Err: message, Query: []byte(query), Line: lineOfPosition(query, int(pgErr.Position))}
+	}
+	return database.Error{OrigErr: err, Err: "migration failed", Query: []byte(query)}
+}
+
+// lineOfPosition returns the 1-based line of the 1-based character position reported by Postgres,
+// or 0 if the position is unknown.
+func lineOfPosition(query string, position int) uint {
+	runes := []rune(query)
+	if position <= 0 || position > len(runes) {
+		return 0
+	}
+	return uint(strings.Count(string(runes[:position]), "\n") + 1)
+}
@@ -0,0 +1,64 @@
+package dbmigrate
+
+import (
+	"context"
+	"strings"
+)
+
+// DumpSchema returns a description of the schema schemaName, usually the DatabaseMigrator's own schema,
+// for committing alongside the migrations so that the effect of a migration shows in review. It lists the
+// types, sequences, tables, views, materialized views and functions of the schema, with the columns,
+// constraints, indexes and triggers of each table beneath it, one per line as defined by Postgres:
+//
+//	table users
+//	  column id: integer NOT NULL
+//	  column email: text
+//	  constraint users_pkey: PRIMARY KEY (id)
+//	  index users_pkey: CREATE UNIQUE INDEX users_pkey ON users USING btree (id)
+//
+// The output is sorted, and does not include the schema name or DatabaseMigrator's bookkeeping tables, so
+// it is the same for any schema with the same migrations applied.
+func (m *DatabaseMigrator) DumpSchema(ctx context.Context, schemaName string) (string, error) {
+	snapshot, err := m.snapshotCatalog(ctx, schemaName)
+	if err != nil {
+		return "", err
+	}
+	return snapshot.dump(), nil
+}
+
+// dump returns the description of the snapshot written by DumpSchema.
+func (s catalogSnapshot) dump() string {
+	owned := make(map[string][]catalogObject)
+	for _, object := range s {
+		if len(object.table) > 0 {
+			owned[object.table] = append(owned[object.table], object)
+		}
+	}
+	var b strings.Builder
+	for _, object := range s {
+		if len(object.table) > 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		writeDumpLine(&b, "", object)
+		if object.kind == "table" || object.kind == "view" || object.kind == "materialized view" {
+			for _, ownedObject := range owned[object.name] {
+				writeDumpLine(&b, "  ", ownedObject)
+			}
+		}
+	}
+	return b.String()
+}
+
+// writeDumpLine writes object to b indented by indent. The lines of a multi-line definition, such as a
+// function body, are indented further.
+func writeDumpLine(b *strings.Builder, indent string, object catalogObject) {
+	b.WriteString(indent + object.kind + " " + object.name)
+	if object.definition != object.kind {
+		definition := strings.ReplaceAll(object.definition, "\n", "\n"+indent+"    ")
+		b.WriteString(": " + definition)
+	}
+	b.WriteString("\n")
+}
@@ -0,0 +1,194 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// GoMigrationFunc is one direction of a GoMigration. It runs in tx, which is committed if it returns nil
+// and rolled back otherwise. The search_path and timeouts of tx's connection are set as for SQL migrations.
+type GoMigrationFunc func(ctx context.Context, tx pgx.Tx) error
+
+// GoMigrationConnFunc is one direction of a GoMigration that runs on conn outside a transaction, for work
+// that commits as it goes, such as a Backfill. The search_path and timeouts of conn are set as for SQL migrations.
+type GoMigrationConnFunc func(ctx context.Context, conn *pgx.Conn) error
+
+// GoMigration is a migration written in Go, for changes SQL cannot express. Go migrations are run in
+// version order along with the migrations from the source.Driver, and are locked and recorded in the
+// version table in the same way. Since Up and Down run in a transaction, a failed Go migration is
+// rolled back and the schema left clean at its previous version, as for a SQL file with a
+// -- dbmigrate:transaction directive.
+type GoMigration struct {
+	Version    uint
+	Identifier string
+	// Up and Down are the functions for each direction. Either may be nil, as a SQL migration may have
+	// no down file.
+	Up   GoMigrationFunc
+	Down GoMigrationFunc
+	// UpNoTransaction and DownNoTransaction are run instead of Up and Down, without a transaction, if set.
+	// If one fails the schema is left dirty, as for a SQL file with a -- dbmigrate:no-transaction directive.
+	UpNoTransaction   GoMigrationConnFunc
+	DownNoTransaction GoMigrationConnFunc
+}
+
+func (g GoMigration) function(direction Direction) GoMigrationFunc {
+	if direction == DirectionUp {
+		return g.Up
+	}
+	return g.Down
+}
+
+func (g GoMigration) connFunction(direction Direction) GoMigrationConnFunc {
+	if direction == DirectionUp {
+		return g.UpNoTransaction
+	}
+	return g.DownNoTransaction
+}
+
+// has returns true if g has a function for direction.
+func (g GoMigration) has(direction Direction) bool {
+	return g.function(direction) != nil || g.connFunction(direction) != nil
+}
+
+// goSource is a source.Driver that serves Go migrations along with the migrations of another source.Driver.
+// The body of a Go migration is a comment naming it, which migrationDriver recognizes by version.
+type goSource struct {
+	source.Driver
+	migrations map[uint]GoMigration
+	// versions are the versions of both kinds of migration in ascending order
+	versions []uint
+}
+
+// newGoSource returns a goSource serving migrations along with those of migrationsSource. It is an error
+// for both to have the same version.
+func newGoSource(migrationsSource source.Driver, migrations []GoMigration) (*goSource, error) {
+	s := &goSource{Driver: migrationsSource, migrations: make(map[uint]GoMigration, len(migrations))}
+	for _, migration := range migrations {
+		if !migration.has(DirectionUp) && !migration.has(DirectionDown) {
+			return nil, fmt.Errorf("migration %d has neither an up nor a down Go function", migration.Version)
+		}
+		for _, direction := range []Direction{DirectionUp, DirectionDown} {
+			if migration.function(direction) != nil && migration.connFunction(direction) != nil {
+				return nil, fmt.Errorf("migration %d has both a transactional and a no-transaction %s Go function",
+					migration.Version, direction)
+			}
+		}
+		if _, exists := s.migrations[migration.Version]; exists {
+			return nil, fmt.Errorf("more than one Go migration for version %d", migration.Version)
+		}
+		s.migrations[migration.Version] = migration
+		s.versions = append(s.versions, migration.Version)
+	}
+	sqlMigrations, err := sourceMigrations(migrationsSource)
+	if err != nil {
+		return nil, err
+	}
+	for _, migration := range sqlMigrations {
+		if goMigration, exists := s.migrations[migration.Version]; exists {
+			return nil, fmt.Errorf("version %d is used by both Go migration %s and migration %s from the source",
+				migration.Version, goMigration.Identifier, migration.Identifier)
+		}
+		s.versions = append(s.versions, migration.Version)
+	}
+	sort.Slice(s.versions, func(i, j int) bool {
+		return s.versions[i] < s.versions[j]
+	})
+	return s, nil
+}
+
+// Open is part of source.Driver, but goSource is only created from an existing source.Driver.
+func (s *goSource) Open(string) (source.Driver, error) {
+	return nil, errors.New("goSource does not support Open")
+}
+
+func (s *goSource) First() (uint, error) {
+	if len(s.versions) == 0 {
+		return 0, &os.PathError{Op: "first", Path: "go migrations", Err: os.ErrNotExist}
+	}
+	return s.versions[0], nil
+}
+
+func (s *goSource) Prev(version uint) (uint, error) {
+	i := sort.Search(len(s.versions), func(i int) bool {
+		return s.versions[i] >= version
+	})
+	if i == 0 || i == len(s.versions) || s.versions[i] != version {
+		return 0, &os.PathError{Op: fmt.Sprintf("prev for version %d", version), Path: "go migrations", Err: os.ErrNotExist}
+	}
+	return s.versions[i-1], nil
+}
+
+func (s *goSource) Next(version uint) (uint, error) {
+	i := sort.Search(len(s.versions), func(i int) bool {
+		return s.versions[i] >= version
+	})
+	if i >= len(s.versions)-1 || s.versions[i] != version {
+		return 0, &os.PathError{Op: fmt.Sprintf("next for version %d", version), Path: "go migrations", Err: os.ErrNotExist}
+	}
+	return s.versions[i+1], nil
+}
+
+func (s *goSource) ReadUp(version uint) (io.ReadCloser, string, error) {
+	return s.read(version, DirectionUp)
+}
+
+func (s *goSource) ReadDown(version uint) (io.ReadCloser, string, error) {
+	return s.read(version, DirectionDown)
+}
+
+func (s *goSource) read(version uint, direction Direction) (io.ReadCloser, string, error) {
+	migration, isGo := s.migrations[version]
+	if !isGo {
+		if direction == DirectionUp {
+			return s.Driver.ReadUp(version)
+		}
+		return s.Driver.ReadDown(version)
+	}
+	if !migration.has(direction) {
+		return nil, "", &os.PathError{Op: fmt.Sprintf("read %s version %d", direction, version), Path: "go migrations", Err: os.ErrNotExist}
+	}
+	body := fmt.Sprintf("-- Go migration %d_%s.%s\n", version, migration.Identifier, direction)
+	return io.NopCloser(strings.NewReader(body)), migration.Identifier, nil
+}
+
+// execGoMigration runs fn on conn in a transaction. conn must be from the pgx database/sql driver.
+func execGoMigration(ctx context.Context, conn *sql.Conn, fn GoMigrationFunc) error {
+	return withPgxConn(conn, func(pgxConn *pgx.Conn) error {
+		if err := pgx.BeginFunc(ctx, pgxConn, func(tx pgx.Tx) error {
+			return fn(ctx, tx)
+		}); err != nil {
+			return fmt.Errorf("error running Go migration: %w", err)
+		}
+		return nil
+	})
+}
+
+// execGoMigrationNoTransaction runs fn on conn without a transaction. conn must be from the pgx database/sql driver.
+func execGoMigrationNoTransaction(ctx context.Context, conn *sql.Conn, fn GoMigrationConnFunc) error {
+	return withPgxConn(conn, func(pgxConn *pgx.Conn) error {
+		if err := fn(ctx, pgxConn); err != nil {
+			return fmt.Errorf("error running Go migration: %w", err)
+		}
+		return nil
+	})
+}
+
+// withPgxConn calls fn with the *pgx.Conn underlying conn, which must be from the pgx database/sql driver.
+func withPgxConn(conn *sql.Conn, fn func(pgxConn *pgx.Conn) error) error {
+	return conn.Raw(func(driverConn any) error {
+		stdlibConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("the pgx database/sql driver is needed, not %T", driverConn)
+		}
+		return fn(stdlibConn.Conn())
+	})
+}
@@ -0,0 +1,91 @@
+package dbmigrate
+
+import (
+	"context"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"testing"
+	"testing/fstest"
+)
+
+func noopGoMigration(context.Context, pgx.Tx) error {
+	return nil
+}
+
+func TestGoSource(t *testing.T) {
+	sqlSource, err := iofs.New(fstest.MapFS{
+		"1_create.up.sql":   {Data: []byte("CREATE TABLE t (id INT);")},
+		"1_create.down.sql": {Data: []byte("DROP TABLE t;")},
+		"3_alter.up.sql":    {Data: []byte("ALTER TABLE t ADD COLUMN name TEXT;")},
+	}, ".")
+	require.NoError(t, err)
+
+	s, err := newGoSource(sqlSource, []GoMigration{
+		{Version: 4, Identifier: "backfill_names", Up: noopGoMigration},
+		{Version: 2, Identifier: "backfill_ids", Up: noopGoMigration, Down: noopGoMigration},
+	})
+	require.NoError(t, err)
+
+	migrations, err := sourceMigrations(s)
+	require.NoError(t, err)
+	assert.Equal(t, []Migration{
+		{Version: 1, Identifier: "create"},
+		{Version: 2, Identifier: "backfill_ids"},
+		{Version: 3, Identifier: "alter"},
+		{Version: 4, Identifier: "backfill_names"},
+	}, migrations)
+
+	previous, err := s.Prev(3)
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), previous)
+	_, err = s.Prev(1)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = s.Next(4)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	r, identifier, err := s.ReadUp(2)
+	require.NoError(t, err)
+	assert.Equal(t, "backfill_ids", identifier)
+	body, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "-- Go migration 2_backfill_ids.up\n", string(body))
+
+	_, _, err = s.ReadDown(4)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	r, identifier, err = s.ReadDown(1)
+	require.NoError(t, err)
+	assert.Equal(t, "create", identifier)
+	require.NoError(t, r.Close())
+}
+
+func TestGoSource_InvalidMigrations(t *testing.T) {
+	sqlSource, err := iofs.New(fstest.MapFS{
+		"1_create.up.sql": {Data: []byte("CREATE TABLE t (id INT);")},
+	}, ".")
+	require.NoError(t, err)
+
+	tests := []struct {
+		scenario   string
+		migrations []GoMigration
+		expected   string
+	}{
+		{"same version as source", []GoMigration{{Version: 1, Identifier: "go", Up: noopGoMigration}},
+			"version 1 is used by both Go migration go and migration create from the source"},
+		{"duplicate version", []GoMigration{{Version: 2, Up: noopGoMigration}, {Version: 2, Down: noopGoMigration}},
+			"more than one Go migration for version 2"},
+		{"no functions", []GoMigration{{Version: 2}}, "migration 2 has neither an up nor a down Go function"},
+		{"both kinds of up function", []GoMigration{{Version: 2, Up: noopGoMigration,
+			UpNoTransaction: func(context.Context, *pgx.Conn) error { return nil }}},
+			"migration 2 has both a transactional and a no-transaction up Go function"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			_, err := newGoSource(sqlSource, tt.migrations)
+			assert.EqualError(t, err, tt.expected)
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+// historyTable is the opt-in audit table with a row for each migration run.
+const historyTable = "schema_migrations_history"
+
+// ErrHistoryNotEnabled is returned by History if the DatabaseMigrator was not configured to keep history.
+var ErrHistoryNotEnabled = errors.New("migration history is not enabled")
+
+// HistoryEntry is a row of the audit history table, recording a single migration run.
+type HistoryEntry struct {
+	ID int64 `json:"id"`
+	Migration
+	Direction  Direction     `json:"direction"`
+	StartedAt  time.Time     `json:"startedAt"`
+	FinishedAt time.Time     `json:"finishedAt"`
+	Duration   time.Duration `json:"duration"`
+	Succeeded  bool          `json:"succeeded"`
+	// Error is the error the migration failed with. Empty if it succeeded.
+	Error string `json:"error,omitempty"`
+	// DatabaseUser is the Postgres user that ran the migration.
+	DatabaseUser string `json:"databaseUser"`
+	// Actor is the configured actor or deployment ID, if any.
+	Actor string `json:"actor,omitempty"`
+	// Checksum is the hex encoded SHA-256 of the migration file. Empty if the source has no file
+	// for the migration in this direction.
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// History returns the audit history of the schema, oldest first. It returns ErrHistoryNotEnabled
+// unless history was turned on with config.MigrationConfig.History or WithHistory.
+func (m *DatabaseMigrator) History(ctx context.Context) ([]HistoryEntry, error) {
+	if m.database.history == nil {
+		return nil, ErrHistoryNotEnabled
+	}
+	return m.database.history.entries(ctx)
+}
+
+// history writes and reads the audit history table of a schema.
+type history struct {
+	conn       *sql.Conn
+	schemaName string
+	actor      string
+}
+
+// execer is satisfied by both *sql.Conn and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func (h *history) qualifiedTable() string {
+	return pgx.Identifier{h.schemaName, historyTable}.Sanitize()
+}
+
+// ensureTable creates the history table if it does not already exist. As with the version table,
+// the caller should hold the migration lock.
+func (h *history) ensureTable(ctx context.Context) error {
+	query := `CREATE TABLE IF NOT EXISTS ` + h.qualifiedTable() + ` (
+		id bigserial primary key,
+		version bigint not null,
+		direction text not null,
+		identifier text not null,
+		started_at timestamptz not null,
+		finished_at timestamptz not null,
+		duration interval not null,
+		succeeded boolean not null,
+		error text,
+		database_user text not null default current_user,
+		actor text,
+		checksum text
+	)`
+	if _, err := h.conn.ExecContext(ctx, query); err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	return nil
+}
+
+// record inserts a row for the migration described by event, which started at started.
+func (h *history) record(ctx context.Context, e execer, event MigrationEvent, started time.Time, migrationChecksum string) error {
+	var errorText *string
+	if event.Err != nil {
+		text := event.Err.Error()
+		errorText = &text
+	}
+	query := `INSERT INTO ` + h.qualifiedTable() + `
+		(version, direction, identifier, started_at, finished_at, duration, succeeded, error, actor, checksum)
+		VALUES ($1, $2, $3, $4, $5, make_interval(secs => $6), $7, $8, NULLIF($9, ''), NULLIF($10, ''))`
+	if _, err := e.ExecContext(ctx, query,
+		int64(event.Version),
+		string(event.Direction),
+		event.Identifier,
+		started,
+		started.Add(event.Elapsed),
+		event.Elapsed.Seconds(),
+		event.Err == nil,
+		errorText,
+		h.actor,
+		migrationChecksum); err != nil {
+		return &database.Error{OrigErr: err, Err: "error recording migration history", Query: []byte(query)}
+	}
+	return nil
+}
+
+func (h *history) entries(ctx context.Context) ([]HistoryEntry, error) {
+	query := `SELECT id, version, direction, identifier, started_at, finished_at, EXTRACT(EPOCH FROM duration)::float8,
+		succeeded, COALESCE(error, ''), database_user, COALESCE(actor, ''), COALESCE(checksum, '')
+		FROM ` + h.qualifiedTable() + ` ORDER BY id`
+	rows, err := h.conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+	entries := []HistoryEntry{}
+	for rows.Next() {
+		var entry HistoryEntry
+		var version int64
+		var direction string
+		var seconds float64
+		if err := rows.Scan(&entry.ID, &version, &direction, &entry.Identifier, &entry.StartedAt, &entry.FinishedAt, &seconds,
+			&entry.Succeeded, &entry.Error, &entry.DatabaseUser, &entry.Actor, &entry.Checksum); err != nil {
+			return nil, closeOnError(err, rows)
+		}
+		entry.Version = uint(version)
+		entry.Direction = Direction(direction)
+		entry.Duration = time.Duration(seconds * float64(time.Second))
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, closeOnError(&database.Error{OrigErr: err, Query: []byte(query)}, rows)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
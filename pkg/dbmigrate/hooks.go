@@ -0,0 +1,84 @@
+package dbmigrate
+
+import (
+	"context"
+	"time"
+)
+
+// MigrationEvent describes a single migration to the migration hooks.
+type MigrationEvent struct {
+	Version   uint
+	Direction Direction
+	// Identifier identifies the migration in the source.Driver. Empty if the source has no
+	// migration for Version in this Direction, in which case only the recorded version changes.
+	Identifier string
+	// Elapsed is the time since the migration started. Zero for BeforeMigration.
+	Elapsed time.Duration
+	// Err is the error the migration failed with. Only set for OnError.
+	Err error
+}
+
+// RunEvent describes a call to Up, Migrate, Steps, Down or Recover to the run hooks.
+type RunEvent struct {
+	// Operation is the method that started the run, for example "up" or "steps".
+	Operation string
+	// Elapsed is the time since the run started. Zero for BeforeRun.
+	Elapsed time.Duration
+	// Err is the error the run failed with, if any. Only set for AfterRun.
+	Err error
+}
+
+// Hooks are functions called as the DatabaseMigrator runs migrations. Any of them may be nil.
+// They are called synchronously, so a slow hook slows the run.
+type Hooks struct {
+	BeforeRun       func(ctx context.Context, event RunEvent)
+	AfterRun        func(ctx context.Context, event RunEvent)
+	BeforeMigration func(ctx context.Context, event MigrationEvent)
+	// AfterMigration is called once a migration has succeeded and its version has been recorded clean.
+	AfterMigration func(ctx context.Context, event MigrationEvent)
+	// OnError is called when a migration fails.
+	OnError func(ctx context.Context, event MigrationEvent)
+}
+
+// hookList calls each of its Hooks in the order they were registered.
+type hookList []Hooks
+
+func (l hookList) beforeRun(ctx context.Context, event RunEvent) {
+	for _, h := range l {
+		if h.BeforeRun != nil {
+			h.BeforeRun(ctx, event)
+		}
+	}
+}
+
+func (l hookList) afterRun(ctx context.Context, event RunEvent) {
+	for _, h := range l {
+		if h.AfterRun != nil {
+			h.AfterRun(ctx, event)
+		}
+	}
+}
+
+func (l hookList) beforeMigration(ctx context.Context, event MigrationEvent) {
+	for _, h := range l {
+		if h.BeforeMigration != nil {
+			h.BeforeMigration(ctx, event)
+		}
+	}
+}
+
+func (l hookList) afterMigration(ctx context.Context, event MigrationEvent) {
+	for _, h := range l {
+		if h.AfterMigration != nil {
+			h.AfterMigration(ctx, event)
+		}
+	}
+}
+
+func (l hookList) onError(ctx context.Context, event MigrationEvent) {
+	for _, h := range l {
+		if h.OnError != nil {
+			h.OnError(ctx, event)
+		}
+	}
+}
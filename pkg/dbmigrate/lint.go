@@ -0,0 +1,523 @@
+package dbmigrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4/source"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LintRule identifies a problem Lint looks for.
+type LintRule string
+
+const (
+	// RuleMissingDown is an up migration without a down migration.
+	RuleMissingDown LintRule = "missing-down"
+	// RuleMissingUp is a down migration without an up migration.
+	RuleMissingUp LintRule = "missing-up"
+	// RuleDuplicateVersion is more than one file for the same version and direction. Only LintFS can
+	// find these, since a source.Driver refuses to load them.
+	RuleDuplicateVersion LintRule = "duplicate-version"
+	// RuleVersionGap is a missing number between two sequential, non-timestamp versions.
+	RuleVersionGap LintRule = "version-gap"
+	// RuleEmptyFile is a migration file with no statements.
+	RuleEmptyFile LintRule = "empty-file"
+	// RuleBelowApplied is a migration that has not been applied but is older than the applied version,
+	// usually merged from a parallel branch. Up will never apply it.
+	RuleBelowApplied LintRule = "below-applied"
+	// RuleVersionFormat is a version that is not a YYYYMMDDhhmmss timestamp.
+	RuleVersionFormat LintRule = "version-format"
+	// RuleFileName is a .sql file whose name golang-migrate cannot parse, so it is ignored. Only LintFS can find these.
+	RuleFileName LintRule = "file-name"
+)
+
+// Severity is how serious a LintFinding is.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	// SeverityInfo is for findings that are not problems, such as a rule that could not be checked.
+	SeverityInfo Severity = "info"
+	// SeverityOff turns a LintRule off.
+	SeverityOff Severity = "off"
+)
+
+// defaultSeverities are the severities of the rules unless changed with WithSeverity.
+var defaultSeverities = map[LintRule]Severity{
+	RuleMissingDown:        SeverityError,
+	RuleMissingUp:          SeverityWarning,
+	RuleDuplicateVersion:   SeverityError,
+	RuleVersionGap:         SeverityWarning,
+	RuleEmptyFile:          SeverityWarning,
+	RuleBelowApplied:       SeverityError,
+	RuleVersionFormat:      SeverityWarning,
+	RuleFileName:           SeverityWarning,
+	RuleVolatileDefault:    SeverityWarning,
+	RuleIndexNotConcurrent: SeverityWarning,
+	RuleColumnType:         SeverityWarning,
+	RuleDropColumn:         SeverityWarning,
+	RuleNotNull:            SeverityWarning,
+	RuleRename:             SeverityWarning,
+}
+
+// LintRules returns every LintRule, in the order findings for the same version are reported.
+func LintRules() []LintRule {
+	return []LintRule{
+		RuleFileName,
+		RuleDuplicateVersion,
+		RuleVersionFormat,
+		RuleVersionGap,
+		RuleMissingDown,
+		RuleMissingUp,
+		RuleEmptyFile,
+		RuleBelowApplied,
+		RuleVolatileDefault,
+		RuleIndexNotConcurrent,
+		RuleColumnType,
+		RuleDropColumn,
+		RuleNotNull,
+		RuleRename,
+	}
+}
+
+// LintFinding is a problem found by Lint.
+type LintFinding struct {
+	Rule     LintRule `json:"rule"`
+	Severity Severity `json:"severity"`
+	// Version is the version of the migration the finding is about, or 0 for RuleFileName.
+	Version uint `json:"version"`
+	// Files are the files the finding is about. Lint does not know file names, so it uses the
+	// conventional name for the version, identifier and direction.
+	Files []string `json:"files"`
+	// Line is the line of the statement the finding is about, for rules that check the SQL of a file.
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+	// Suggestion is a safer alternative, for rules that check the SQL of a file.
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+func (f LintFinding) String() string {
+	location := strings.Join(f.Files, ", ")
+	if f.Line > 0 {
+		location = fmt.Sprintf("%s:%d", location, f.Line)
+	}
+	if len(location) == 0 {
+		return fmt.Sprintf("%s: %s (%s)", f.Severity, f.Message, f.Rule)
+	}
+	return fmt.Sprintf("%s %s: %s (%s)", f.Severity, location, f.Message, f.Rule)
+}
+
+// LintReport is the result of Lint.
+type LintReport struct {
+	Findings []LintFinding `json:"findings"`
+}
+
+// HasErrors returns true if any finding has SeverityError.
+func (r *LintReport) HasErrors() bool {
+	for _, finding := range r.Findings {
+		if finding.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Sort orders the findings by version, then by rule in LintRules order, as Lint does. Use it after
+// adding findings from another report.
+func (r *LintReport) Sort() {
+	order := map[LintRule]int{}
+	for i, rule := range LintRules() {
+		order[rule] = i
+	}
+	sort.SliceStable(r.Findings, func(i, j int) bool {
+		if r.Findings[i].Version != r.Findings[j].Version {
+			return r.Findings[i].Version < r.Findings[j].Version
+		}
+		return order[r.Findings[i].Rule] < order[r.Findings[j].Rule]
+	})
+}
+
+// WriteText writes a line for each finding to w, followed by an indented line with its suggestion if it has one.
+func (r *LintReport) WriteText(w io.Writer) error {
+	for _, finding := range r.Findings {
+		if _, err := fmt.Fprintln(w, finding); err != nil {
+			return err
+		}
+		if len(finding.Suggestion) > 0 {
+			if _, err := fmt.Fprintf(w, "    suggestion: %s\n", finding.Suggestion); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// LintOption configures Lint.
+type LintOption func(*lintOptions)
+
+type lintOptions struct {
+	severities map[LintRule]Severity
+	// appliedVersion is the current version of the schema, if known
+	appliedVersion    uint
+	hasAppliedVersion bool
+	// appliedVersions are the versions known to have been applied, if known. If it is nil when
+	// hasAppliedVersion is true, RuleBelowApplied cannot be checked.
+	appliedVersions map[uint]bool
+}
+
+func newLintOptions(opts []LintOption) *lintOptions {
+	o := &lintOptions{severities: make(map[LintRule]Severity, len(defaultSeverities))}
+	for rule, severity := range defaultSeverities {
+		o.severities[rule] = severity
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithSeverity changes the severity of rule. Use SeverityOff to turn it off.
+func WithSeverity(rule LintRule, severity Severity) LintOption {
+	return func(o *lintOptions) {
+		o.severities[rule] = severity
+	}
+}
+
+// WithAppliedVersions lets Lint check for RuleBelowApplied: any migration older than current that is
+// not in applied is reported. DatabaseMigrator.Lint sets this from the schema.
+func WithAppliedVersions(current uint, applied []uint) LintOption {
+	return func(o *lintOptions) {
+		o.appliedVersion = current
+		o.hasAppliedVersion = true
+		o.appliedVersions = make(map[uint]bool, len(applied))
+		for _, version := range applied {
+			o.appliedVersions[version] = true
+		}
+	}
+}
+
+// withUnknownAppliedVersions tells Lint that the schema is at version current, but not which older
+// versions have been applied, so that it reports that RuleBelowApplied could not be checked.
+func withUnknownAppliedVersions(current uint) LintOption {
+	return func(o *lintOptions) {
+		o.appliedVersion = current
+		o.hasAppliedVersion = true
+		o.appliedVersions = nil
+	}
+}
+
+// lintFile is a migration file as seen by the linter.
+type lintFile struct {
+	name  string
+	body  string
+	empty bool
+}
+
+// lintMigration is all the files for a single version.
+type lintMigration struct {
+	version uint
+	files   map[Direction][]lintFile
+}
+
+// linter collects findings.
+type linter struct {
+	opts     *lintOptions
+	findings []LintFinding
+}
+
+func (l *linter) report(rule LintRule, version uint, files []string, format string, args ...any) {
+	l.add(LintFinding{
+		Rule:    rule,
+		Version: version,
+		Files:   files,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// add records finding with the configured severity of its rule, unless the rule is off.
+func (l *linter) add(finding LintFinding) {
+	finding.Severity = l.opts.severities[finding.Rule]
+	if finding.Severity == SeverityOff {
+		return
+	}
+	l.findings = append(l.findings, finding)
+}
+
+// Lint walks the migrations served by migrationsSource and reports missing up or down migrations, empty
+// files, non-timestamp versions and gaps between sequential versions. It also checks the SQL of up migrations
+// for statements that lock or rewrite live tables; see RuleVolatileDefault and the rules after it. Duplicate versions and file names
+// that cannot be parsed are only found by LintFS, and unapplied old migrations only with WithAppliedVersions
+// or by DatabaseMigrator.Lint.
+func Lint(migrationsSource source.Driver, opts ...LintOption) (*LintReport, error) {
+	var migrations []*lintMigration
+	version, err := migrationsSource.First()
+	for err == nil {
+		migration := &lintMigration{version: version, files: map[Direction][]lintFile{}}
+		for _, direction := range []Direction{DirectionUp, DirectionDown} {
+			body, identifier, readErr := readMigration(migrationsSource, version, direction)
+			if errors.Is(readErr, os.ErrNotExist) {
+				continue
+			}
+			if readErr != nil {
+				return nil, readErr
+			}
+			migration.files[direction] = []lintFile{{
+				name:  fmt.Sprintf("%d_%s.%s.sql", version, identifier, direction),
+				body:  string(body),
+				empty: len(splitStatements(string(body))) == 0,
+			}}
+		}
+		migrations = append(migrations, migration)
+		version, err = migrationsSource.Next(version)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error reading migration versions from source: %w", err)
+	}
+	l := &linter{opts: newLintOptions(opts)}
+	l.lint(migrations)
+	return l.result(), nil
+}
+
+// LintFS is Lint for the migration files in dir of fsys. Since it sees the files themselves it also
+// reports duplicate versions and .sql files that golang-migrate would ignore because of their names.
+func LintFS(fsys fs.FS, dir string, opts ...LintOption) (*LintReport, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations directory %s: %w", dir, err)
+	}
+	l := &linter{opts: newLintOptions(opts)}
+	byVersion := map[uint]*lintMigration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		parsed, err := source.DefaultParse(name)
+		if err != nil {
+			if strings.HasSuffix(name, ".sql") {
+				l.report(RuleFileName, 0, []string{name}, "name does not match {version}_{name}.{up|down}.sql, so it is ignored")
+			}
+			continue
+		}
+		body, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration file %s: %w", name, err)
+		}
+		migration, ok := byVersion[parsed.Version]
+		if !ok {
+			migration = &lintMigration{version: parsed.Version, files: map[Direction][]lintFile{}}
+			byVersion[parsed.Version] = migration
+		}
+		direction := Direction(parsed.Direction)
+		migration.files[direction] = append(migration.files[direction], lintFile{
+			name:  name,
+			body:  string(body),
+			empty: len(splitStatements(string(body))) == 0,
+		})
+	}
+	migrations := make([]*lintMigration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	l.lint(migrations)
+	return l.result(), nil
+}
+
+// Lint is the package level Lint for the DatabaseMigrator's source, which also reports migrations older
+// than the applied version that have not been applied. Which versions have been applied is only known if
+// history or checksums are enabled and record something; otherwise an info finding says that the check
+// could not be run. Neither table is backfilled, so migrations older than the earliest one they record are
+// assumed to have been applied before it was enabled.
+func (m *DatabaseMigrator) Lint(ctx context.Context, opts ...LintOption) (*LintReport, error) {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if status.HasVersion {
+		applied, known, err := m.appliedVersions(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if known {
+			opts = append([]LintOption{WithAppliedVersions(status.Version, applied)}, opts...)
+		} else {
+			opts = append([]LintOption{withUnknownAppliedVersions(status.Version)}, opts...)
+		}
+	}
+	return Lint(m.source, opts...)
+}
+
+// appliedVersions returns the versions of the source that the history or checksums tables show to be
+// applied, along with those older than the earliest version either records. known is false if neither is
+// enabled, or if the enabled table records nothing yet.
+func (m *DatabaseMigrator) appliedVersions(ctx context.Context) (applied []uint, known bool, err error) {
+	isApplied, earliest, known, err := m.recordedVersions(ctx)
+	if err != nil || !known {
+		return nil, false, err
+	}
+	migrations, err := sourceMigrations(m.source)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, migration := range migrations {
+		up, recorded := isApplied[migration.Version]
+		switch {
+		case recorded:
+			if up {
+				applied = append(applied, migration.Version)
+			}
+		case migration.Version < earliest:
+			applied = append(applied, migration.Version)
+		case m.database.history == nil:
+			// nothing runs for a version without an up migration, so checksums has no row for it
+			identifier, err := directionIdentifier(m.source, migration.Version, DirectionUp)
+			if err != nil {
+				return nil, false, err
+			}
+			if len(identifier) == 0 {
+				applied = append(applied, migration.Version)
+			}
+		}
+	}
+	return applied, true, nil
+}
+
+// recordedVersions returns whether each version recorded by the history table, or failing that the
+// checksums table, is applied, and the earliest version recorded. History is preferred since it records
+// every migration run, where checksums only has a row for a migration with an up file. known is false if
+// neither is enabled or the table has no records.
+func (m *DatabaseMigrator) recordedVersions(ctx context.Context) (isApplied map[uint]bool, earliest uint, known bool, err error) {
+	isApplied = map[uint]bool{}
+	var versions []uint
+	switch {
+	case m.database.history != nil:
+		entries, err := m.database.history.entries(ctx)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		// the latest successful run of each version says whether it is applied
+		for _, entry := range entries {
+			versions = append(versions, entry.Version)
+			if entry.Succeeded {
+				isApplied[entry.Version] = entry.Direction == DirectionUp
+			}
+		}
+	case m.database.checksums != nil:
+		recorded, err := m.database.checksums.recorded(ctx)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		for _, r := range recorded {
+			versions = append(versions, r.Version)
+			isApplied[r.Version] = true
+		}
+	}
+	if len(versions) == 0 {
+		return nil, 0, false, nil
+	}
+	return isApplied, slices.Min(versions), true, nil
+}
+
+func (l *linter) lint(migrations []*lintMigration) {
+	var previousSequential *lintMigration
+	for _, migration := range migrations {
+		l.lintFiles(migration)
+		if isTimestampVersion(migration.version) {
+			previousSequential = nil
+		} else {
+			l.report(RuleVersionFormat, migration.version, migration.names(), "version %d is not a YYYYMMDDhhmmss timestamp", migration.version)
+			if previousSequential != nil && migration.version != previousSequential.version+1 {
+				l.report(RuleVersionGap, migration.version, migration.names(), "versions %d to %d are missing",
+					previousSequential.version+1, migration.version-1)
+			}
+			previousSequential = migration
+		}
+		if l.opts.hasAppliedVersion && l.opts.appliedVersions != nil &&
+			migration.version < l.opts.appliedVersion && !l.opts.appliedVersions[migration.version] {
+			l.report(RuleBelowApplied, migration.version, migration.names(),
+				"version %d has not been applied but is older than the applied version %d, so it will never be applied",
+				migration.version, l.opts.appliedVersion)
+		}
+	}
+	if l.opts.hasAppliedVersion && l.opts.appliedVersions == nil && l.opts.severities[RuleBelowApplied] != SeverityOff {
+		l.findings = append(l.findings, LintFinding{
+			Rule:     RuleBelowApplied,
+			Severity: SeverityInfo,
+			Version:  l.opts.appliedVersion,
+			Files:    []string{},
+			Message: "not checked: without history or checksums records it is not known which migrations older " +
+				"than the applied version have been applied",
+		})
+	}
+}
+
+// lintFiles checks the files of a single version.
+func (l *linter) lintFiles(migration *lintMigration) {
+	ups, downs := migration.files[DirectionUp], migration.files[DirectionDown]
+	for _, direction := range []Direction{DirectionUp, DirectionDown} {
+		if files := migration.files[direction]; len(files) > 1 {
+			l.report(RuleDuplicateVersion, migration.version, fileNames(files), "%d %s migrations for version %d",
+				len(files), direction, migration.version)
+		}
+	}
+	if len(ups) > 0 && len(downs) == 0 {
+		l.report(RuleMissingDown, migration.version, fileNames(ups), "no down migration")
+	}
+	if len(downs) > 0 && len(ups) == 0 {
+		l.report(RuleMissingUp, migration.version, fileNames(downs), "no up migration")
+	}
+	for _, direction := range []Direction{DirectionUp, DirectionDown} {
+		for _, file := range migration.files[direction] {
+			if file.empty {
+				l.report(RuleEmptyFile, migration.version, []string{file.name}, "file has no statements")
+			}
+		}
+	}
+	for _, file := range ups {
+		l.checkSQL(migration.version, file)
+	}
+}
+
+// result returns the findings ordered by version, then by rule in LintRules order.
+func (l *linter) result() *LintReport {
+	report := &LintReport{Findings: append([]LintFinding{}, l.findings...)}
+	report.Sort()
+	return report
+}
+
+func (m *lintMigration) names() []string {
+	return append(fileNames(m.files[DirectionUp]), fileNames(m.files[DirectionDown])...)
+}
+
+func fileNames(files []lintFile) []string {
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.name)
+	}
+	return names
+}
+
+// timestampVersionFormat is the format of timestamp versions, for example 20250509172500.
+const timestampVersionFormat = "20060102150405"
+
+func isTimestampVersion(version uint) bool {
+	s := strconv.FormatUint(uint64(version), 10)
+	if len(s) != len(timestampVersionFormat) {
+		return false
+	}
+	_, err := time.Parse(timestampVersionFormat, s)
+	return err == nil
+}
@@ -0,0 +1,223 @@
+package dbmigrate_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/pennsieve/dbmigrate-go/pkg/config"
+	"github.com/pennsieve/dbmigrate-go/pkg/dbmigrate"
+	"github.com/pennsieve/dbmigrate-go/pkg/dbmigratetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func sqlFile(body string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(body)}
+}
+
+// lintFS has one of each problem Lint can find
+var lintFS = fstest.MapFS{
+	"20250101000000_ok.up.sql":              sqlFile("CREATE TABLE ok (id INT);"),
+	"20250101000000_ok.down.sql":            sqlFile("DROP TABLE ok;"),
+	"20250102000000_no_down.up.sql":         sqlFile("CREATE TABLE no_down (id INT);"),
+	"20250103000000_no_up.down.sql":         sqlFile("DROP TABLE no_up;"),
+	"20250104000000_empty.up.sql":           sqlFile("  \n-- nothing to do yet\n"),
+	"20250104000000_empty.down.sql":         sqlFile("SELECT 1;"),
+	"20250105000000_first.up.sql":           sqlFile("SELECT 1;"),
+	"20250105000000_first.down.sql":         sqlFile("SELECT 1;"),
+	"20250105000000_second_branch.up.sql":   sqlFile("SELECT 2;"),
+	"20251399000000_bad_timestamp.up.sql":   sqlFile("SELECT 1;"),
+	"20251399000000_bad_timestamp.down.sql": sqlFile("SELECT 1;"),
+	"add_column.up.sql":                     sqlFile("SELECT 1;"),
+	"README.md":                             sqlFile("not a migration"),
+}
+
+// findingsText returns the findings of report one per line, to make failures easy to read
+func findingsText(report *dbmigrate.LintReport) string {
+	var lines []string
+	for _, finding := range report.Findings {
+		lines = append(lines, finding.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestLintFS(t *testing.T) {
+	report, err := dbmigrate.LintFS(lintFS, ".")
+	require.NoError(t, err)
+
+	assert.Equal(t, strings.Join([]string{
+		"warning add_column.up.sql: name does not match {version}_{name}.{up|down}.sql, so it is ignored (file-name)",
+		"error 20250102000000_no_down.up.sql: no down migration (missing-down)",
+		"warning 20250103000000_no_up.down.sql: no up migration (missing-up)",
+		"warning 20250104000000_empty.up.sql: file has no statements (empty-file)",
+		"error 20250105000000_first.up.sql, 20250105000000_second_branch.up.sql: 2 up migrations for version 20250105000000 (duplicate-version)",
+		"warning 20251399000000_bad_timestamp.up.sql, 20251399000000_bad_timestamp.down.sql: version 20251399000000 is not a YYYYMMDDhhmmss timestamp (version-format)",
+	}, "\n"), findingsText(report))
+	assert.True(t, report.HasErrors())
+}
+
+func TestLintFS_Severity(t *testing.T) {
+	report, err := dbmigrate.LintFS(lintFS, ".",
+		dbmigrate.WithSeverity(dbmigrate.RuleMissingDown, dbmigrate.SeverityWarning),
+		dbmigrate.WithSeverity(dbmigrate.RuleDuplicateVersion, dbmigrate.SeverityOff),
+		dbmigrate.WithSeverity(dbmigrate.RuleEmptyFile, dbmigrate.SeverityError))
+	require.NoError(t, err)
+
+	var rules []dbmigrate.LintRule
+	for _, finding := range report.Findings {
+		rules = append(rules, finding.Rule)
+		switch finding.Rule {
+		case dbmigrate.RuleMissingDown:
+			assert.Equal(t, dbmigrate.SeverityWarning, finding.Severity)
+		case dbmigrate.RuleEmptyFile:
+			assert.Equal(t, dbmigrate.SeverityError, finding.Severity)
+		}
+	}
+	assert.NotContains(t, rules, dbmigrate.RuleDuplicateVersion)
+	assert.True(t, report.HasErrors())
+}
+
+func TestLint(t *testing.T) {
+	sequential := fstest.MapFS{
+		"1_create.up.sql":   sqlFile("CREATE TABLE t (id INT);"),
+		"1_create.down.sql": sqlFile("DROP TABLE t;"),
+		"2_alter.up.sql":    sqlFile("ALTER TABLE t ADD COLUMN name TEXT;"),
+		"2_alter.down.sql":  sqlFile("ALTER TABLE t DROP COLUMN name;"),
+		"5_index.up.sql":    sqlFile("CREATE INDEX t_name ON t (name);"),
+		"5_index.down.sql":  sqlFile(""),
+	}
+	migrationsSource, err := iofs.New(sequential, ".")
+	require.NoError(t, err)
+
+	report, err := dbmigrate.Lint(migrationsSource,
+		dbmigrate.WithSeverity(dbmigrate.RuleVersionFormat, dbmigrate.SeverityOff),
+		dbmigrate.WithAppliedVersions(2, []uint{2}))
+	require.NoError(t, err)
+
+	assert.Equal(t, strings.Join([]string{
+		"error 1_create.up.sql, 1_create.down.sql: version 1 has not been applied but is older than the applied version 2, so it will never be applied (below-applied)",
+		"warning 5_index.up.sql, 5_index.down.sql: versions 3 to 4 are missing (version-gap)",
+		"warning 5_index.down.sql: file has no statements (empty-file)",
+		"warning 5_index.up.sql:1: CREATE INDEX without CONCURRENTLY blocks writes to t until the index is built (index-not-concurrent)",
+	}, "\n"), findingsText(report))
+}
+
+func TestLint_TestMigrations(t *testing.T) {
+	migrationsSource, err := iofs.New(migrationsFS, "testdata/migrations")
+	require.NoError(t, err)
+
+	report, err := dbmigrate.Lint(migrationsSource)
+	require.NoError(t, err)
+	assert.Empty(t, report.Findings)
+}
+
+func TestDatabaseMigrator_Lint(t *testing.T) {
+	ctx := context.Background()
+
+	migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+	require.NoError(t, err)
+
+	applied := fstest.MapFS{
+		"20250101000000_first.up.sql":   sqlFile("CREATE TABLE lint_first (id INT);"),
+		"20250101000000_first.down.sql": sqlFile("DROP TABLE lint_first;"),
+		"20250103000000_third.up.sql":   sqlFile("CREATE TABLE lint_third (id INT);"),
+		"20250103000000_third.down.sql": sqlFile("DROP TABLE lint_third;"),
+	}
+	appliedSource, err := iofs.New(applied, ".")
+	require.NoError(t, err)
+	migrator, _ := newTestMigrator(ctx, t, migrateConfig, appliedSource, dbmigrate.WithChecksumMode(config.ChecksumWarn))
+	require.NoError(t, migrator.Up())
+
+	// a migration from a parallel branch merged after the third was applied
+	merged := fstest.MapFS{
+		"20250102000000_second.up.sql":   sqlFile("CREATE TABLE lint_second (id INT);"),
+		"20250102000000_second.down.sql": sqlFile("DROP TABLE lint_second;"),
+	}
+	for name, file := range applied {
+		merged[name] = file
+	}
+	mergedSource, err := iofs.New(merged, ".")
+	require.NoError(t, err)
+	mergedMigrator, err := dbmigrate.NewLocalMigrator(ctx, migrateConfig, mergedSource, dbmigrate.WithChecksumMode(config.ChecksumWarn))
+	require.NoError(t, err)
+	defer dbmigratetest.Close(t, mergedMigrator)
+
+	report, err := mergedMigrator.Lint(ctx)
+	require.NoError(t, err)
+	require.Len(t, report.Findings, 1, findingsText(report))
+	assert.Equal(t, dbmigrate.RuleBelowApplied, report.Findings[0].Rule)
+	assert.Equal(t, uint(20250102000000), report.Findings[0].Version)
+
+	// without checksums or history it is not known which versions were applied
+	unknownMigrator, err := dbmigrate.NewLocalMigrator(ctx, migrateConfig, mergedSource)
+	require.NoError(t, err)
+	defer dbmigratetest.Close(t, unknownMigrator)
+	report, err = unknownMigrator.Lint(ctx)
+	require.NoError(t, err)
+	require.Len(t, report.Findings, 1, findingsText(report))
+	assert.Equal(t, dbmigrate.RuleBelowApplied, report.Findings[0].Rule)
+	assert.Equal(t, dbmigrate.SeverityInfo, report.Findings[0].Severity)
+	assert.Equal(t, uint(20250103000000), report.Findings[0].Version)
+	assert.False(t, report.HasErrors())
+}
+
+func TestLintReport_Sort(t *testing.T) {
+	report := &dbmigrate.LintReport{Findings: []dbmigrate.LintFinding{
+		{Rule: dbmigrate.RuleMissingDown, Version: 3},
+		{Rule: dbmigrate.RuleEmptyFile, Version: 1},
+		// added from another report
+		{Rule: dbmigrate.RuleBelowApplied, Version: 2},
+		{Rule: dbmigrate.RuleFileName, Version: 0},
+	}}
+	report.Sort()
+	var order []string
+	for _, finding := range report.Findings {
+		order = append(order, fmt.Sprintf("%d %s", finding.Version, finding.Rule))
+	}
+	assert.Equal(t, []string{"0 file-name", "1 empty-file", "2 below-applied", "3 missing-down"}, order)
+}
+
+func TestDatabaseMigrator_Lint_HistoryEnabledLater(t *testing.T) {
+	ctx := context.Background()
+
+	migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+	require.NoError(t, err)
+
+	applied := fstest.MapFS{
+		"20250101000000_first.up.sql":  sqlFile("CREATE TABLE lint_first (id INT);"),
+		"20250103000000_third.up.sql":  sqlFile("CREATE TABLE lint_third (id INT);"),
+		"20250104000000_fourth.up.sql": sqlFile("CREATE TABLE lint_fourth (id INT);"),
+	}
+	appliedSource, err := iofs.New(applied, ".")
+	require.NoError(t, err)
+	migrator, _ := newTestMigrator(ctx, t, migrateConfig, appliedSource)
+	// applied before history was enabled, so it has no history entry
+	require.NoError(t, migrator.Migrate(20250101000000))
+
+	historyMigrator, err := dbmigrate.NewLocalMigrator(ctx, migrateConfig, appliedSource, dbmigrate.WithHistory(""))
+	require.NoError(t, err)
+	defer dbmigratetest.Close(t, historyMigrator)
+	require.NoError(t, historyMigrator.Up())
+
+	// the first migration is not reported, but one merged after the third was applied is
+	merged := fstest.MapFS{
+		"20250103120000_merged.up.sql": sqlFile("CREATE TABLE lint_merged (id INT);"),
+	}
+	for name, file := range applied {
+		merged[name] = file
+	}
+	mergedSource, err := iofs.New(merged, ".")
+	require.NoError(t, err)
+	mergedMigrator, err := dbmigrate.NewLocalMigrator(ctx, migrateConfig, mergedSource, dbmigrate.WithHistory(""))
+	require.NoError(t, err)
+	defer dbmigratetest.Close(t, mergedMigrator)
+
+	report, err := mergedMigrator.Lint(ctx, dbmigrate.WithSeverity(dbmigrate.RuleMissingDown, dbmigrate.SeverityOff))
+	require.NoError(t, err)
+	require.Len(t, report.Findings, 1, findingsText(report))
+	assert.Equal(t, dbmigrate.RuleBelowApplied, report.Findings[0].Rule)
+	assert.Equal(t, uint(20250103120000), report.Findings[0].Version)
+}
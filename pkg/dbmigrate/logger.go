@@ -1,21 +1,128 @@
 package dbmigrate
 
-import "log"
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // logger implements migrate.Logger; if we don't pass migrate.Migrate one of
 // these, it won't do its internal logging.
+// With a *slog.Logger, golang-migrate's messages are logged with fields for the
+// migration's version, direction and duration. Otherwise they go to log.Printf.
 type logger struct {
 	IsVerbose bool
+	slog      *slog.Logger
 }
 
-func newLogger(verbose bool) *logger {
-	return &logger{IsVerbose: verbose}
+func newLogger(verbose bool, slogger *slog.Logger, schemaName string) *logger {
+	if slogger != nil {
+		slogger = slogger.With(slog.String("schema", schemaName))
+	}
+	return &logger{IsVerbose: verbose, slog: slogger}
 }
 
 func (l *logger) Printf(format string, v ...interface{}) {
-	log.Printf(format, v...)
+	if l.slog == nil {
+		log.Printf(format, v...)
+		return
+	}
+	level, message, attrs := slogRecord(format, v)
+	if level == slog.LevelDebug && l.IsVerbose {
+		level = slog.LevelInfo
+	}
+	l.slog.LogAttrs(context.Background(), level, message, attrs...)
 }
 
+// info logs message with attrs, or with log.Printf if there is no *slog.Logger.
+func (l *logger) info(ctx context.Context, message string, attrs ...slog.Attr) {
+	if l.slog == nil {
+		parts := []string{message}
+		for _, attr := range attrs {
+			parts = append(parts, attr.String())
+		}
+		log.Print(strings.Join(parts, " "))
+		return
+	}
+	l.slog.LogAttrs(ctx, slog.LevelInfo, message, attrs...)
+}
+
+// Verbose is true if verbose logging is configured or, with a *slog.Logger, if it logs at debug level.
 func (l *logger) Verbose() bool {
-	return l.IsVerbose
+	return l.IsVerbose || (l.slog != nil && l.slog.Enabled(context.Background(), slog.LevelDebug))
+}
+
+// The formats golang-migrate logs migrations with. Those only logged when Verbose is true are
+// logged at debug level, or at info level if verbose logging is configured.
+const (
+	finishedVerboseFormat = "Finished %v (read %v, ran %v)\n"
+	finishedFormat        = "%v (%v)\n"
+)
+
+var debugFormats = map[string]string{
+	"Start buffering %v\n":          "start buffering migration",
+	"Scheduled %v\n":                "scheduled migration",
+	"Read and execute %v\n":         "read and execute migration",
+	"Closing source and database\n": "closing source and database",
+}
+
+// migrationLogStringPattern matches golang-migrate's description of a migration, for example "20250509172500/u create_table"
+var migrationLogStringPattern = regexp.MustCompile(`^(\d+)/([ud]) (.*)$`)
+
+// slogRecord converts a golang-migrate or dbmigrate Printf call into a slog level, message and attributes.
+func slogRecord(format string, v []interface{}) (slog.Level, string, []slog.Attr) {
+	switch {
+	case format == finishedVerboseFormat && len(v) == 3:
+		attrs := append(migrationAttrs(v[0]), durationAttr("read_duration", v[1]), durationAttr("duration", v[2]))
+		return slog.LevelInfo, "finished migration", attrs
+	case format == finishedFormat && len(v) == 2:
+		return slog.LevelInfo, "finished migration", append(migrationAttrs(v[0]), durationAttr("duration", v[1]))
+	}
+	if message, isDebug := debugFormats[format]; isDebug {
+		var attrs []slog.Attr
+		if len(v) > 0 {
+			attrs = migrationAttrs(v[0])
+		}
+		return slog.LevelDebug, message, attrs
+	}
+	message := strings.TrimSpace(fmt.Sprintf(format, v...))
+	if after, isError := strings.CutPrefix(message, "error: "); isError {
+		return slog.LevelError, after, nil
+	}
+	if after, isWarning := strings.CutPrefix(message, "warning: "); isWarning {
+		return slog.LevelWarn, after, nil
+	}
+	return slog.LevelInfo, message, nil
+}
+
+func migrationAttrs(logString interface{}) []slog.Attr {
+	matches := migrationLogStringPattern.FindStringSubmatch(fmt.Sprint(logString))
+	if matches == nil {
+		return []slog.Attr{slog.String("migration", fmt.Sprint(logString))}
+	}
+	direction := DirectionUp
+	if matches[2] == "d" {
+		direction = DirectionDown
+	}
+	version, err := strconv.ParseUint(matches[1], 10, 0)
+	if err != nil {
+		return []slog.Attr{slog.String("migration", fmt.Sprint(logString))}
+	}
+	return []slog.Attr{
+		slog.Uint64("version", version),
+		slog.String("direction", string(direction)),
+		slog.String("identifier", matches[3]),
+	}
+}
+
+func durationAttr(key string, value interface{}) slog.Attr {
+	if duration, isDuration := value.(time.Duration); isDuration {
+		return slog.Duration(key, duration)
+	}
+	return slog.Any(key, value)
 }
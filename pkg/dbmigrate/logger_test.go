@@ -0,0 +1,123 @@
+package dbmigrate
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogger_Slog(t *testing.T) {
+	tests := []struct {
+		scenario string
+		format   string
+		args     []interface{}
+		expected map[string]interface{}
+	}{
+		{"verbose finished migration",
+			finishedVerboseFormat,
+			[]interface{}{"20250509172500/u create_table", 2 * time.Millisecond, 15 * time.Millisecond},
+			map[string]interface{}{
+				"level":         "INFO",
+				"msg":           "finished migration",
+				"schema":        "test_schema",
+				"version":       float64(20250509172500),
+				"direction":     "up",
+				"identifier":    "create_table",
+				"read_duration": float64(2 * time.Millisecond),
+				"duration":      float64(15 * time.Millisecond),
+			}},
+		{"finished migration",
+			finishedFormat,
+			[]interface{}{"20250319124829/d create_updated_at_trigger", 3 * time.Millisecond},
+			map[string]interface{}{
+				"level":      "INFO",
+				"msg":        "finished migration",
+				"schema":     "test_schema",
+				"version":    float64(20250319124829),
+				"direction":  "down",
+				"identifier": "create_updated_at_trigger",
+				"duration":   float64(3 * time.Millisecond),
+			}},
+		{"verbose only message",
+			"Read and execute %v\n",
+			[]interface{}{"20250509172500/u create_table"},
+			map[string]interface{}{
+				"level":      "DEBUG",
+				"msg":        "read and execute migration",
+				"schema":     "test_schema",
+				"version":    float64(20250509172500),
+				"direction":  "up",
+				"identifier": "create_table",
+			}},
+		{"error",
+			"error: %v",
+			[]interface{}{"no migration found for version 1"},
+			map[string]interface{}{
+				"level":  "ERROR",
+				"msg":    "no migration found for version 1",
+				"schema": "test_schema",
+			}},
+		{"warning",
+			"warning: source error closing DatabaseMigrator: %v",
+			[]interface{}{"closed"},
+			map[string]interface{}{
+				"level":  "WARN",
+				"msg":    "source error closing DatabaseMigrator: closed",
+				"schema": "test_schema",
+			}},
+		{"plain message",
+			"no changes",
+			nil,
+			map[string]interface{}{
+				"level":  "INFO",
+				"msg":    "no changes",
+				"schema": "test_schema",
+			}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			var buf bytes.Buffer
+			slogger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{
+				Level: slog.LevelDebug,
+				ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+					if a.Key == slog.TimeKey {
+						return slog.Attr{}
+					}
+					return a
+				},
+			}))
+			l := newLogger(false, slogger, "test_schema")
+			assert.True(t, l.Verbose())
+
+			l.Printf(tt.format, tt.args...)
+
+			var record map[string]interface{}
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+			assert.Equal(t, tt.expected, record)
+		})
+	}
+}
+
+func TestLogger_SlogVerbose(t *testing.T) {
+	var buf bytes.Buffer
+	infoLogger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	assert.False(t, newLogger(false, infoLogger, "test_schema").Verbose())
+	assert.True(t, newLogger(true, infoLogger, "test_schema").Verbose())
+
+	// without verbose logging, verbose messages are logged at debug level, which the handler drops
+	newLogger(false, infoLogger, "test_schema").Printf("Scheduled %v\n", "20250509172500/u create_table")
+	assert.Empty(t, buf.String())
+	// with it, they are logged at info level
+	newLogger(true, infoLogger, "test_schema").Printf("Scheduled %v\n", "20250509172500/u create_table")
+	assert.True(t, strings.Contains(buf.String(), "level=INFO msg=\"scheduled migration\" schema=test_schema version=20250509172500"))
+	buf.Reset()
+	newLogger(true, infoLogger, "test_schema").Printf("no changes")
+	assert.True(t, strings.Contains(buf.String(), "msg=\"no changes\" schema=test_schema"))
+}
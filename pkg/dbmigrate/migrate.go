@@ -6,98 +6,276 @@ import (
 	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/feature/rds/auth"
 	"github.com/golang-migrate/migrate/v4"
-	"github.com/golang-migrate/migrate/v4/database/pgx/v5"
 	"github.com/golang-migrate/migrate/v4/source"
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/pennsieve/dbmigrate-go/pkg/config"
 	"io"
 	"net"
 	"net/url"
+	"os"
 	"strings"
+	"time"
 )
 
+// ErrFloorVersion is returned when a rollback would leave the schema below the configured floor version.
+var ErrFloorVersion = errors.New("rollback would go below floor version")
+
+// ErrTooFewConnections is returned when the caller's *sql.DB or pgxpool.Pool is limited to fewer connections than
+// a DatabaseMigrator uses at once.
+var ErrTooFewConnections = errors.New("too few connections for migrations")
+
+// minConnections is the number of connections a DatabaseMigrator uses at once: one it holds for the
+// migration lock and version table, and one each migration runs on.
+const minConnections = 2
+
+// rdsDefaultSSLMode is the sslmode used for RDS connections if none is configured
+const rdsDefaultSSLMode = "verify-full"
+
 type DatabaseMigrator struct {
-	wrapped *migrate.Migrate
+	wrapped      *migrate.Migrate
+	source       source.Driver
+	database     *migrationDriver
+	floorVersion uint
+	hooks        hookList
+	log          *logger
 }
 
-func NewRDSProxyDatabaseMigrator(ctx context.Context, migrateConfig config.Config, migrationsSource source.Driver, awsConfig aws.Config) (*DatabaseMigrator, error) {
-	authenticationToken, err := auth.BuildAuthToken(
-		ctx,
-		fmt.Sprintf("%s:%d", migrateConfig.PostgresDB.Host, migrateConfig.PostgresDB.Port),
-		awsConfig.Region,
-		migrateConfig.PostgresDB.User,
-		awsConfig.Credentials,
+// NewRDSProxyDatabaseMigrator returns a DatabaseMigrator that authenticates with RDS IAM auth tokens. A fresh
+// token is minted from awsConfig.Credentials for each new connection, since each token is only valid for 15 minutes.
+// Unless migrateConfig sets an SSL mode, connections use sslmode=verify-full.
+func NewRDSProxyDatabaseMigrator(ctx context.Context, migrateConfig config.Config, migrationsSource source.Driver, awsConfig aws.Config, opts ...Option) (*DatabaseMigrator, error) {
+	pgConfig := migrateConfig.PostgresDB
+	if len(pgConfig.SSLMode) == 0 {
+		// IAM auth tokens must not be sent over a connection that could fall back to plaintext
+		pgConfig.SSLMode = rdsDefaultSSLMode
+	}
+	db, err := openDB(
+		datasourceName(pgConfig, ""),
+		stdlib.OptionBeforeConnect(rdsAuthTokenBeforeConnect(awsConfig)),
 	)
 	if err != nil {
-		return nil, fmt.Errorf("error building auth token for Migrator: %w", err)
+		return nil, err
 	}
 	return newDatabaseMigrator(
 		ctx,
-		migrateConfig.PostgresDB.User,
-		authenticationToken,
-		migrateConfig.PostgresDB.Host,
-		migrateConfig.PostgresDB.Port,
-		migrateConfig.PostgresDB.Database,
+		db,
+		true,
 		migrateConfig.PostgresDB.Schema,
 		migrationsSource,
-		migrateConfig.VerboseLogging)
+		newOptions(migrateConfig, opts))
 }
 
-func NewLocalMigrator(ctx context.Context, migrateConfig config.Config, migrationsSource source.Driver) (*DatabaseMigrator, error) {
+func NewLocalMigrator(ctx context.Context, migrateConfig config.Config, migrationsSource source.Driver, opts ...Option) (*DatabaseMigrator, error) {
 	if migrateConfig.PostgresDB.Password == nil {
 		return nil, fmt.Errorf("password cannot be nil for local Migrator")
 	}
+	db, err := openDB(datasourceName(migrateConfig.PostgresDB, *migrateConfig.PostgresDB.Password))
+	if err != nil {
+		return nil, err
+	}
 	return newDatabaseMigrator(
 		ctx,
-		migrateConfig.PostgresDB.User,
-		*migrateConfig.PostgresDB.Password,
-		migrateConfig.PostgresDB.Host,
-		migrateConfig.PostgresDB.Port,
-		migrateConfig.PostgresDB.Database,
+		db,
+		true,
 		migrateConfig.PostgresDB.Schema,
 		migrationsSource,
-		migrateConfig.VerboseLogging)
+		newOptions(migrateConfig, opts))
+}
 
+// NewDatabaseMigratorWithDB returns a DatabaseMigrator that runs migrations in schemaName using an existing db.
+// Since the caller opened db, Close leaves it open. Options are applied to a zero config.Config, so a
+// floor version, timeouts or verbose logging must be set with opts.
+//
+// The DatabaseMigrator holds one connection of db until it is closed and runs each migration on a second, so
+// it returns ErrTooFewConnections if db is limited to one connection rather than wait forever for the second.
+func NewDatabaseMigratorWithDB(ctx context.Context, db *sql.DB, schemaName string, migrationsSource source.Driver, opts ...Option) (*DatabaseMigrator, error) {
+	if err := checkMaxConnections(db.Stats().MaxOpenConnections); err != nil {
+		return nil, err
+	}
+	return newDatabaseMigrator(ctx, db, false, schemaName, migrationsSource, newOptions(config.Config{}, opts))
+}
+
+// NewDatabaseMigratorWithPool is NewDatabaseMigratorWithDB for a pgx pool. Close leaves the pool open. Like db,
+// the pool must allow at least two connections.
+func NewDatabaseMigratorWithPool(ctx context.Context, pool *pgxpool.Pool, schemaName string, migrationsSource source.Driver, opts ...Option) (*DatabaseMigrator, error) {
+	if err := checkMaxConnections(int(pool.Config().MaxConns)); err != nil {
+		return nil, err
+	}
+	// closing this *sql.DB only releases its connections back to pool
+	return newDatabaseMigrator(ctx, stdlib.OpenDBFromPool(pool), true, schemaName, migrationsSource, newOptions(config.Config{}, opts))
+}
+
+// checkMaxConnections returns ErrTooFewConnections if maxConnections, a pool's limit or zero for no limit, is
+// less than minConnections.
+func checkMaxConnections(maxConnections int) error {
+	if maxConnections > 0 && maxConnections < minConnections {
+		return fmt.Errorf("%w: a DatabaseMigrator uses %d connections at once, but the pool is limited to %d",
+			ErrTooFewConnections, minConnections, maxConnections)
+	}
+	return nil
 }
 
 // Up looks at the currently active migration version and will migrate all the way up (applying all up migrations).
 func (m *DatabaseMigrator) Up() error {
-	if err := m.wrapped.Up(); err != nil {
-		if errors.Is(err, migrate.ErrNoChange) {
-			m.wrapped.Log.Printf("no changes")
-			return nil
-		}
+	return m.UpContext(context.Background())
+}
+
+// UpContext is Up with a context. If ctx is cancelled, the run stops after the current migration. If ctx
+// has a deadline, reaching it also cancels the statement in flight. If checksums are enabled, applied
+// migrations are first verified as by Verify.
+func (m *DatabaseMigrator) UpContext(ctx context.Context) error {
+	if err := m.verifyBeforeUp(ctx); err != nil {
 		return err
 	}
-	return nil
+	return m.run(ctx, "up", m.wrapped.Up)
 }
 
 // Migrate looks at the currently active migration version, then migrates either up or down to the specified version.
 func (m *DatabaseMigrator) Migrate(version uint) error {
-	if err := m.wrapped.Migrate(version); err != nil {
-		if errors.Is(err, migrate.ErrNoChange) {
-			m.wrapped.Log.Printf("no changes")
+	return m.MigrateContext(context.Background(), version)
+}
+
+// MigrateContext is Migrate with a context, which is handled as it is by UpContext.
+func (m *DatabaseMigrator) MigrateContext(ctx context.Context, version uint) error {
+	return m.run(ctx, "migrate", func() error {
+		return m.wrapped.Migrate(version)
+	})
+}
+
+// Steps looks at the currently active migration version and applies n migrations if n is positive, or
+// rolls back -n migrations if n is negative. If a floor version is configured, a rollback that would
+// leave the schema below it is refused with ErrFloorVersion before anything is run.
+func (m *DatabaseMigrator) Steps(n int) error {
+	return m.StepsContext(context.Background(), n)
+}
+
+// StepsContext is Steps with a context, which is handled as it is by UpContext.
+func (m *DatabaseMigrator) StepsContext(ctx context.Context, n int) error {
+	if n < 0 {
+		if err := m.checkFloorVersion(-n); err != nil {
+			return err
+		}
+	}
+	return m.run(ctx, "steps", func() error {
+		return m.wrapped.Steps(n)
+	})
+}
+
+// checkFloorVersion returns an ErrFloorVersion error if rolling back the given number of
+// migrations would leave the schema below the floor version.
+func (m *DatabaseMigrator) checkFloorVersion(rollbacks int) error {
+	if m.floorVersion == 0 {
+		return nil
+	}
+	version, _, err := m.wrapped.Version()
+	if err != nil {
+		if errors.Is(err, migrate.ErrNilVersion) {
+			// nothing to roll back
 			return nil
 		}
 		return err
 	}
+	for i := 0; i < rollbacks; i++ {
+		prev, err := m.source.Prev(version)
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: rolling back %d migrations would remove all migrations, floor is %d",
+				ErrFloorVersion, rollbacks, m.floorVersion)
+		}
+		if err != nil {
+			return fmt.Errorf("error reading previous version of %d from source: %w", version, err)
+		}
+		version = prev
+	}
+	if version < m.floorVersion {
+		return fmt.Errorf("%w: rolling back %d migrations would leave version %d, floor is %d",
+			ErrFloorVersion, rollbacks, version, m.floorVersion)
+	}
 	return nil
 }
 
 // Down looks at the currently active migration version and will migrate all the way down (applying all down migrations).
 func (m *DatabaseMigrator) Down() error {
-	if err := m.wrapped.Down(); err != nil {
+	return m.DownContext(context.Background())
+}
+
+// DownContext is Down with a context, which is handled as it is by UpContext.
+func (m *DatabaseMigrator) DownContext(ctx context.Context) error {
+	return m.run(ctx, "down", m.wrapped.Down)
+}
+
+// run calls migrateFunc with the database.Driver using ctx, and with ctx wired into golang-migrate's
+// GracefulStop channel. If golang-migrate takes the stop signal, run returns an error wrapping the cause
+// of ctx, and since golang-migrate will not run any further migrations, the DatabaseMigrator should be
+// closed. A signal golang-migrate did not take before migrateFunc returned is withdrawn, leaving later runs
+// unaffected. operation identifies the run to the run hooks and names its span.
+func (m *DatabaseMigrator) run(ctx context.Context, operation string, migrateFunc func() error) (err error) {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("migration run not started: %w", err)
+	}
+	ctx, endSpan := m.database.telemetry.startRun(ctx, operation)
+	defer func() {
+		endSpan(err)
+	}()
+	m.hooks.beforeRun(ctx, RunEvent{Operation: operation})
+	started := time.Now()
+	defer func() {
+		m.hooks.afterRun(ctx, RunEvent{Operation: operation, Elapsed: time.Since(started), Err: err})
+	}()
+
+	m.database.setContext(ctx)
+	defer m.database.setContext(nil)
+
+	stopWatching := m.stopOnDone(ctx)
+	err = migrateFunc()
+	stopped := stopWatching()
+	if err != nil {
 		if errors.Is(err, migrate.ErrNoChange) {
 			m.wrapped.Log.Printf("no changes")
 			return nil
 		}
 		return err
 	}
+	if stopped {
+		return fmt.Errorf("migration run stopped: %w", context.Cause(ctx))
+	}
 	return nil
 }
 
+// stopOnDone sends a stop signal to golang-migrate if ctx is done before the returned function is called.
+// The returned function reports whether golang-migrate took the signal, withdrawing it if not.
+func (m *DatabaseMigrator) stopOnDone(ctx context.Context) func() bool {
+	finished := make(chan struct{})
+	stopped := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			m.wrapped.Log.Printf("stopping after current migration: %v", context.Cause(ctx))
+			select {
+			case m.wrapped.GracefulStop <- true:
+			default:
+			}
+			stopped <- true
+		case <-finished:
+			stopped <- false
+		}
+	}()
+	return func() bool {
+		close(finished)
+		if !<-stopped {
+			return false
+		}
+		// golang-migrate only reads the signal between migrations, so it may have finished without it
+		select {
+		case <-m.wrapped.GracefulStop:
+			return false
+		default:
+			return true
+		}
+	}
+}
+
 // Drop will drop all tables in the schema.
 // Used for testing
 func (m *DatabaseMigrator) Drop() error {
@@ -119,37 +297,48 @@ func (m *DatabaseMigrator) CloseAndLogError() {
 	}
 }
 
-func newDatabaseMigrator(ctx context.Context, username, password, host string,
-	port int,
-	databaseName string,
+// newDatabaseMigrator returns a DatabaseMigrator that runs migrations in schemaName using db. If closeDB is
+// true, db is closed when the DatabaseMigrator is, or if it cannot be created.
+func newDatabaseMigrator(ctx context.Context,
+	db *sql.DB,
+	closeDB bool,
 	schemaName string,
 	migrationsSource source.Driver,
-	verboseLogging bool) (*DatabaseMigrator, error) {
+	opts *options) (*DatabaseMigrator, error) {
+
+	closeDBOnError := func(err error) error {
+		if closeDB {
+			return closeOnError(err, db)
+		}
+		return err
+	}
+
+	if len(opts.goMigrations) > 0 {
+		goMigrationsSource, err := newGoSource(migrationsSource, opts.goMigrations)
+		if err != nil {
+			return nil, closeDBOnError(err)
+		}
+		migrationsSource = goMigrationsSource
+	}
+
+	log := newLogger(opts.verboseLogging, opts.logger, schemaName)
+	if err := connect(ctx, db, opts.connectRetry, log); err != nil {
+		return nil, closeDBOnError(err)
+	}
 
 	// Migrate needs two things, a database.Driver to access Postgres, and a source.Driver to read the
 	// migration files.
 
 	// Create database.Driver and create schema (which Migrate won't do on its own)
-	db, err := sql.Open("pgx",
-		datasourceName(username,
-			password,
-			host,
-			port,
-			databaseName,
-			schemaName),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("error opening database: %w", err)
-	}
-	// WithInstance will try to ensure that golang-migrate's migration table exists, so we need
-	// to create the schema before it is called.
+	// The database.Driver will try to ensure that golang-migrate's migration table exists, so we need
+	// to create the schema before it is created.
 	createSchemaQuery := fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %q", schemaName)
 	if _, err := db.ExecContext(ctx, createSchemaQuery); err != nil {
-		return nil, closeOnError(fmt.Errorf("error creating schema %q: %w", schemaName, err), db)
+		return nil, closeDBOnError(fmt.Errorf("error creating schema %q: %w", schemaName, err))
 	}
-	driver, err := pgx.WithInstance(db, &pgx.Config{SchemaName: schemaName})
+	driver, err := newMigrationDriver(ctx, db, closeDB, schemaName, migrationsSource, opts)
 	if err != nil {
-		return nil, closeOnError(fmt.Errorf("error creating migration database.Driver: %w", err), db)
+		return nil, closeDBOnError(fmt.Errorf("error creating migration database.Driver: %w", err))
 	}
 
 	// Now we can create the Migrate instance
@@ -162,17 +351,38 @@ func newDatabaseMigrator(ctx context.Context, username, password, host string,
 		return nil, closeOnError(fmt.Errorf("error creating Migrate instance: %w", err), driver, migrationsSource)
 	}
 	// we use this logger too in a couple of places, so need it non-nil
-	m.Log = newLogger(verboseLogging)
-	return &DatabaseMigrator{wrapped: m}, nil
+	m.Log = log
+	return &DatabaseMigrator{
+		wrapped:      m,
+		source:       migrationsSource,
+		database:     driver,
+		floorVersion: opts.migration.FloorVersion,
+		hooks:        opts.hooks,
+		log:          log,
+	}, nil
 }
 
-func datasourceName(username, password, host string, port int, databaseName string, schemaName string) string {
+func datasourceName(pgConfig config.PostgresDBConfig, password string) string {
+	query := url.Values{}
+	query.Set("search_path", pgConfig.Schema)
+	if len(pgConfig.SSLMode) > 0 {
+		query.Set("sslmode", pgConfig.SSLMode)
+	}
+	if len(pgConfig.SSLRootCert) > 0 {
+		query.Set("sslrootcert", pgConfig.SSLRootCert)
+	}
+	if len(pgConfig.SSLCert) > 0 {
+		query.Set("sslcert", pgConfig.SSLCert)
+	}
+	if len(pgConfig.SSLKey) > 0 {
+		query.Set("sslkey", pgConfig.SSLKey)
+	}
 	datasource := url.URL{
 		Scheme:   "postgres",
-		User:     url.UserPassword(username, password),
-		Host:     net.JoinHostPort(host, fmt.Sprintf("%d", port)),
-		Path:     databaseName,
-		RawQuery: fmt.Sprintf("search_path=%s", schemaName),
+		User:     url.UserPassword(pgConfig.User, password),
+		Host:     net.JoinHostPort(pgConfig.Host, fmt.Sprintf("%d", pgConfig.Port)),
+		Path:     pgConfig.Database,
+		RawQuery: query.Encode(),
 	}
 	return datasource.String()
 }
@@ -1,24 +1,50 @@
 package dbmigrate_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"database/sql"
 	"embed"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"github.com/golang-migrate/migrate/v4/source"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
-	"github.com/pennsieve/dbmigrate-go/internal/test"
+	"github.com/jackc/pgx/v5/pgxpool"
+	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/pennsieve/dbmigrate-go/pkg/config"
 	"github.com/pennsieve/dbmigrate-go/pkg/dbmigrate"
+	"github.com/pennsieve/dbmigrate-go/pkg/dbmigratetest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"log/slog"
+	"net"
+	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 )
 
 //go:embed testdata/migrations/*.sql
 var migrationsFS embed.FS
 
+// failingMigrationsFS contains a migration that always fails part way through
+//
+//go:embed testdata/failing_migrations/*.sql
+var failingMigrationsFS embed.FS
+
+// slowMigrationsFS contains a migration that takes a few seconds to run
+//
+//go:embed testdata/slow_migrations/*.sql
+var slowMigrationsFS embed.FS
+
 const schema = "test_schema"
 
 func TestDatabaseMigrator(t *testing.T) {
@@ -29,11 +55,14 @@ func TestDatabaseMigrator(t *testing.T) {
 		{"test Up", testUp},
 		{"test Migrate", testMigrate},
 		{"Up and Down run without error", testUpAndDown},
+		{"test Status", testStatus},
+		{"test Plan", testPlan},
+		{"test Steps", testSteps},
 	}
 
 	ctx := context.Background()
 
-	testSettings := test.NewTestSettings(schema)
+	testSettings := dbmigratetest.NewTestSettings(schema)
 	migrateConfig, err := config.LoadConfig(testSettings)
 	require.NoError(t, err)
 
@@ -42,26 +71,60 @@ func TestDatabaseMigrator(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.scenario, func(t *testing.T) {
-			// make a migrator for each test and pass it into the function so that
-			// we can take care of cleaning it up here
-			migrator, err := dbmigrate.NewLocalMigrator(ctx, migrateConfig, migrationsSource)
-			require.NoError(t, err)
-
-			// also pass in a plain pgx.Conn to let the test function run any verifications on the migrated schema
-			verificationConn, err := test.NewPostgresDBFromConfig(t, migrateConfig.PostgresDB).Connect(ctx, migrateConfig.PostgresDB.Database)
-			require.NoError(t, err)
-
-			t.Cleanup(func() {
-				require.NoError(t, migrator.Drop())
-				test.Close(t, migrator)
-				test.CloseConnection(ctx, t, verificationConn)
-			})
-
+			migrator, verificationConn := newTestMigrator(ctx, t, migrateConfig, migrationsSource)
 			tt.tstFunc(t, migrator, verificationConn)
 		})
 	}
 }
 
+// newTestMigrator makes a migrator for a single test and takes care of cleaning it up
+// when the test completes. It also returns a plain pgx.Conn to let the test run any
+// verifications on the migrated schema
+func newTestMigrator(ctx context.Context, t *testing.T, migrateConfig config.Config, migrationsSource source.Driver, opts ...dbmigrate.Option) (*dbmigrate.DatabaseMigrator, *pgx.Conn) {
+	t.Helper()
+	migrator, err := dbmigrate.NewLocalMigrator(ctx, migrateConfig, migrationsSource, opts...)
+	require.NoError(t, err)
+
+	verificationConn, err := dbmigratetest.NewPostgresDBFromConfig(t, migrateConfig.PostgresDB).Connect(ctx, migrateConfig.PostgresDB.Database)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, migrator.Drop())
+		dbmigratetest.Close(t, migrator)
+		dbmigratetest.CloseConnection(ctx, t, verificationConn)
+	})
+	return migrator, verificationConn
+}
+
+func TestDatabaseMigrator_FloorVersion(t *testing.T) {
+	ctx := context.Background()
+
+	testSettings := dbmigratetest.NewTestSettings(schema)
+	testSettings[config.MigrationFloorVersionKey] = "20250319124829"
+	migrateConfig, err := config.LoadConfig(testSettings)
+	require.NoError(t, err)
+
+	migrationsSource, err := iofs.New(migrationsFS, "testdata/migrations")
+	require.NoError(t, err)
+
+	migrator, _ := newTestMigrator(ctx, t, migrateConfig, migrationsSource)
+
+	require.NoError(t, migrator.Up())
+
+	// would remove every migration
+	require.ErrorIs(t, migrator.Steps(-2), dbmigrate.ErrFloorVersion)
+	status, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint(20250509172500), status.Version)
+
+	// leaves the schema at the floor
+	require.NoError(t, migrator.Steps(-1))
+	require.ErrorIs(t, migrator.Steps(-1), dbmigrate.ErrFloorVersion)
+
+	// Down is not limited by the floor
+	require.NoError(t, migrator.Down())
+}
+
 func testUp(t *testing.T, migrator *dbmigrate.DatabaseMigrator, verificationConn *pgx.Conn) {
 
 	require.NoError(t, migrator.Up())
@@ -142,3 +205,959 @@ func testUpAndDown(t *testing.T, migrator *dbmigrate.DatabaseMigrator, _ *pgx.Co
 
 	require.NoError(t, migrator.Down())
 }
+
+func testStatus(t *testing.T, migrator *dbmigrate.DatabaseMigrator, _ *pgx.Conn) {
+	ctx := context.Background()
+
+	initial, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	assert.False(t, initial.HasVersion)
+	assert.False(t, initial.Dirty)
+	assert.Empty(t, initial.Applied)
+	assert.Equal(t, []dbmigrate.Migration{
+		{Version: 20250319124829, Identifier: "create_updated_at_trigger"},
+		{Version: 20250509172500, Identifier: "create_table"},
+	}, initial.Pending)
+
+	require.NoError(t, migrator.Migrate(20250319124829))
+
+	partial, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	assert.True(t, partial.HasVersion)
+	assert.Equal(t, uint(20250319124829), partial.Version)
+	assert.False(t, partial.Dirty)
+	assert.Equal(t, []dbmigrate.Migration{{Version: 20250319124829, Identifier: "create_updated_at_trigger"}}, partial.Applied)
+	assert.Equal(t, []dbmigrate.Migration{{Version: 20250509172500, Identifier: "create_table"}}, partial.Pending)
+
+	require.NoError(t, migrator.Up())
+
+	complete, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint(20250509172500), complete.Version)
+	assert.Len(t, complete.Applied, 2)
+	assert.Empty(t, complete.Pending)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = migrator.Status(cancelled)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func testPlan(t *testing.T, migrator *dbmigrate.DatabaseMigrator, verificationConn *pgx.Conn) {
+	ctx := context.Background()
+
+	upPlan, err := migrator.PlanUp()
+	require.NoError(t, err)
+	assert.False(t, upPlan.HasFromVersion)
+	assert.Equal(t, uint(20250509172500), upPlan.TargetVersion)
+	require.Len(t, upPlan.Steps, 2)
+	assert.Equal(t, uint(20250319124829), upPlan.Steps[0].Version)
+	assert.Equal(t, dbmigrate.DirectionUp, upPlan.Steps[0].Direction)
+	assert.Contains(t, upPlan.Steps[0].SQL, "CREATE OR REPLACE FUNCTION update_updated_at_column()")
+	assert.Equal(t, uint(20250509172500), upPlan.Steps[1].Version)
+	assert.Equal(t, "create_table", upPlan.Steps[1].Identifier)
+	assert.Contains(t, upPlan.String(), "-- [2/2] up 20250509172500 create_table")
+
+	// planning must not execute anything
+	var tableName *string
+	require.NoError(t, verificationConn.QueryRow(ctx, fmt.Sprintf(`SELECT to_regclass('%s.test_table')`, schema)).Scan(&tableName))
+	assert.Nil(t, tableName)
+
+	require.NoError(t, migrator.Up())
+
+	downPlan, err := migrator.Plan(20250319124829)
+	require.NoError(t, err)
+	assert.True(t, downPlan.HasFromVersion)
+	assert.Equal(t, uint(20250509172500), downPlan.FromVersion)
+	require.Len(t, downPlan.Steps, 1)
+	assert.Equal(t, dbmigrate.DirectionDown, downPlan.Steps[0].Direction)
+	assert.Contains(t, downPlan.Steps[0].SQL, "DROP TABLE IF EXISTS test_table")
+
+	planJSON, err := downPlan.JSON()
+	require.NoError(t, err)
+	var decoded dbmigrate.MigrationPlan
+	require.NoError(t, json.Unmarshal(planJSON, &decoded))
+	assert.Equal(t, *downPlan, decoded)
+
+	noChangePlan, err := migrator.PlanUp()
+	require.NoError(t, err)
+	assert.Empty(t, noChangePlan.Steps)
+
+	_, err = migrator.Plan(12345)
+	assert.Error(t, err)
+}
+
+func testSteps(t *testing.T, migrator *dbmigrate.DatabaseMigrator, _ *pgx.Conn) {
+	ctx := context.Background()
+
+	require.NoError(t, migrator.Steps(1))
+	status, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint(20250319124829), status.Version)
+
+	require.NoError(t, migrator.Steps(1))
+	status, err = migrator.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint(20250509172500), status.Version)
+
+	require.NoError(t, migrator.Steps(-2))
+	status, err = migrator.Status(ctx)
+	require.NoError(t, err)
+	assert.False(t, status.HasVersion)
+
+	// nothing left to roll back
+	require.Error(t, migrator.Steps(-1))
+}
+
+func TestDatabaseMigrator_Recover(t *testing.T) {
+	tests := []struct {
+		scenario        string
+		action          dbmigrate.RecoveryAction
+		expectedVersion uint
+	}{
+		{"mark clean", dbmigrate.RecoverMarkClean, 20250601110000},
+		{"rollback", dbmigrate.RecoverRollback, 20250601100000},
+	}
+
+	ctx := context.Background()
+
+	migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+	require.NoError(t, err)
+
+	migrationsSource, err := iofs.New(failingMigrationsFS, "testdata/failing_migrations")
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			migrator, _ := newTestMigrator(ctx, t, migrateConfig, migrationsSource)
+
+			_, err := migrator.Recover(tt.action)
+			require.ErrorIs(t, err, dbmigrate.ErrNotDirty)
+
+			require.Error(t, migrator.Up())
+
+			dirtyState, err := migrator.DirtyState()
+			require.NoError(t, err)
+			require.NotNil(t, dirtyState)
+			assert.Equal(t, uint(20250601110000), dirtyState.Version)
+			assert.Equal(t, "alter_recover_table", dirtyState.Identifier)
+			assert.True(t, dirtyState.HasPreviousVersion)
+			assert.Equal(t, uint(20250601100000), dirtyState.PreviousVersion)
+
+			recovered, err := migrator.Recover(tt.action)
+			require.NoError(t, err)
+			assert.Equal(t, dirtyState, recovered)
+
+			status, err := migrator.Status(ctx)
+			require.NoError(t, err)
+			assert.False(t, status.Dirty)
+			assert.Equal(t, tt.expectedVersion, status.Version)
+
+			dirtyState, err = migrator.DirtyState()
+			require.NoError(t, err)
+			assert.Nil(t, dirtyState)
+		})
+	}
+}
+
+func TestDatabaseMigrator_RecoverRollbackRecorded(t *testing.T) {
+	ctx := context.Background()
+
+	migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+	require.NoError(t, err)
+
+	migrationsSource, err := iofs.New(failingMigrationsFS, "testdata/failing_migrations")
+	require.NoError(t, err)
+
+	var events []string
+	migrator, _ := newTestMigrator(ctx, t, migrateConfig, migrationsSource,
+		dbmigrate.WithHooks(recordingHooks(&events)),
+		dbmigrate.WithHistory("recovery"))
+
+	require.Error(t, migrator.Up())
+	events = nil
+
+	_, err = migrator.Recover(dbmigrate.RecoverRollback)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"before run recover",
+		"before down 20250601110000 alter_recover_table",
+		"after down 20250601110000 alter_recover_table",
+		"after run recover (failed: false)",
+	}, events)
+
+	history, err := migrator.History(ctx)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	recovery := history[2]
+	assert.Equal(t, uint(20250601110000), recovery.Version)
+	assert.Equal(t, dbmigrate.DirectionDown, recovery.Direction)
+	assert.True(t, recovery.Succeeded)
+	assert.Equal(t, "recovery", recovery.Actor)
+
+	// a second rollback finds the schema clean, as one that waited for the lock would
+	_, err = migrator.Recover(dbmigrate.RecoverRollback)
+	require.ErrorIs(t, err, dbmigrate.ErrNotDirty)
+}
+
+func TestDatabaseMigrator_Force(t *testing.T) {
+	ctx := context.Background()
+
+	migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+	require.NoError(t, err)
+
+	migrationsSource, err := iofs.New(migrationsFS, "testdata/migrations")
+	require.NoError(t, err)
+
+	migrator, _ := newTestMigrator(ctx, t, migrateConfig, migrationsSource)
+
+	require.NoError(t, migrator.Force(20250319124829))
+	status, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint(20250319124829), status.Version)
+	assert.False(t, status.Dirty)
+
+	require.NoError(t, migrator.Force(-1))
+	status, err = migrator.Status(ctx)
+	require.NoError(t, err)
+	assert.False(t, status.HasVersion)
+}
+
+func TestDatabaseMigrator_Context(t *testing.T) {
+	ctx := context.Background()
+
+	migrationsSource, err := iofs.New(slowMigrationsFS, "testdata/slow_migrations")
+	require.NoError(t, err)
+
+	t.Run("cancelled before run", func(t *testing.T) {
+		migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+		require.NoError(t, err)
+		migrator, _ := newTestMigrator(ctx, t, migrateConfig, migrationsSource)
+
+		cancelledCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		require.ErrorIs(t, migrator.UpContext(cancelledCtx), context.Canceled)
+
+		status, err := migrator.Status(ctx)
+		require.NoError(t, err)
+		assert.False(t, status.HasVersion)
+	})
+
+	t.Run("deadline cancels in-flight statement", func(t *testing.T) {
+		migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+		require.NoError(t, err)
+		migrator, _ := newTestMigrator(ctx, t, migrateConfig, migrationsSource)
+
+		deadlineCtx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		start := time.Now()
+		require.Error(t, migrator.UpContext(deadlineCtx))
+		assert.Less(t, time.Since(start), 3*time.Second)
+
+		dirtyState, err := migrator.DirtyState()
+		require.NoError(t, err)
+		require.NotNil(t, dirtyState)
+		assert.Equal(t, uint(20250701110000), dirtyState.Version)
+	})
+
+	t.Run("statement timeout", func(t *testing.T) {
+		testSettings := dbmigratetest.NewTestSettings(schema)
+		testSettings[config.MigrationStatementTimeoutKey] = "500ms"
+		migrateConfig, err := config.LoadConfig(testSettings)
+		require.NoError(t, err)
+		migrator, _ := newTestMigrator(ctx, t, migrateConfig, migrationsSource)
+
+		require.ErrorContains(t, migrator.Up(), "statement timeout")
+
+		dirtyState, err := migrator.DirtyState()
+		require.NoError(t, err)
+		require.NotNil(t, dirtyState)
+		assert.Equal(t, uint(20250701110000), dirtyState.Version)
+	})
+}
+
+func TestNewDatabaseMigratorWithDB(t *testing.T) {
+	ctx := context.Background()
+
+	migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+	require.NoError(t, err)
+	pgConfig := migrateConfig.PostgresDB
+	// no search_path, so the migrator must take care of running in the schema itself
+	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s",
+		pgConfig.Host, pgConfig.Port, pgConfig.User, *pgConfig.Password, pgConfig.Database)
+
+	migrationsSource, err := iofs.New(migrationsFS, "testdata/migrations")
+	require.NoError(t, err)
+
+	tests := []struct {
+		scenario    string
+		newMigrator func(t *testing.T) (*dbmigrate.DatabaseMigrator, func() error)
+	}{
+		{"sql.DB", func(t *testing.T) (*dbmigrate.DatabaseMigrator, func() error) {
+			db, err := sql.Open("pgx", dsn)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				require.NoError(t, db.Close())
+			})
+			migrator, err := dbmigrate.NewDatabaseMigratorWithDB(ctx, db, schema, migrationsSource, dbmigrate.WithVerboseLogging(true))
+			require.NoError(t, err)
+			return migrator, func() error { return db.PingContext(ctx) }
+		}},
+		{"pgxpool.Pool", func(t *testing.T) (*dbmigrate.DatabaseMigrator, func() error) {
+			pool, err := pgxpool.New(ctx, dsn)
+			require.NoError(t, err)
+			t.Cleanup(pool.Close)
+			migrator, err := dbmigrate.NewDatabaseMigratorWithPool(ctx, pool, schema, migrationsSource, dbmigrate.WithVerboseLogging(true))
+			require.NoError(t, err)
+			return migrator, func() error { return pool.Ping(ctx) }
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			migrator, ping := tt.newMigrator(t)
+
+			require.NoError(t, migrator.Up())
+
+			verificationConn, err := dbmigratetest.NewPostgresDBFromConfig(t, pgConfig).Connect(ctx, pgConfig.Database)
+			require.NoError(t, err)
+			defer dbmigratetest.CloseConnection(ctx, t, verificationConn)
+
+			var tableName *string
+			require.NoError(t, verificationConn.QueryRow(ctx, fmt.Sprintf(`SELECT to_regclass('%s.test_table')`, schema)).Scan(&tableName))
+			require.NotNil(t, tableName)
+			require.NoError(t, verificationConn.QueryRow(ctx, `SELECT to_regclass('public.test_table')`).Scan(&tableName))
+			assert.Nil(t, tableName)
+
+			require.NoError(t, migrator.Drop())
+			dbmigratetest.Close(t, migrator)
+
+			// caller's connection is left open
+			require.NoError(t, ping())
+		})
+	}
+}
+
+func TestNewDatabaseMigratorWithDB_TooFewConnections(t *testing.T) {
+	ctx := context.Background()
+
+	// neither constructor connects before checking the limit
+	dsn := "host=localhost port=5432 user=postgres dbname=postgres"
+
+	migrationsSource, err := iofs.New(migrationsFS, "testdata/migrations")
+	require.NoError(t, err)
+
+	t.Run("sql.DB", func(t *testing.T) {
+		db, err := sql.Open("pgx", dsn)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			require.NoError(t, db.Close())
+		})
+		db.SetMaxOpenConns(1)
+
+		_, err = dbmigrate.NewDatabaseMigratorWithDB(ctx, db, schema, migrationsSource)
+		require.ErrorIs(t, err, dbmigrate.ErrTooFewConnections)
+	})
+
+	t.Run("pgxpool.Pool", func(t *testing.T) {
+		poolConfig, err := pgxpool.ParseConfig(dsn)
+		require.NoError(t, err)
+		poolConfig.MaxConns = 1
+		pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+		require.NoError(t, err)
+		t.Cleanup(pool.Close)
+
+		_, err = dbmigrate.NewDatabaseMigratorWithPool(ctx, pool, schema, migrationsSource)
+		require.ErrorIs(t, err, dbmigrate.ErrTooFewConnections)
+	})
+}
+
+func TestNewLocalMigrator_ConnectRetry(t *testing.T) {
+	ctx := context.Background()
+
+	// nothing is listening on this port
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	require.NoError(t, listener.Close())
+
+	testSettings := dbmigratetest.NewTestSettings(schema)
+	testSettings[config.PostgresHostKey] = "127.0.0.1"
+	testSettings[config.PostgresPortKey] = fmt.Sprintf("%d", port)
+	testSettings[config.ConnectMaxAttemptsKey] = "3"
+	testSettings[config.ConnectInitialBackoffKey] = "10ms"
+	migrateConfig, err := config.LoadConfig(testSettings)
+	require.NoError(t, err)
+	// env vars set for CI would otherwise point us at the real database
+	migrateConfig.PostgresDB.Host = "127.0.0.1"
+	migrateConfig.PostgresDB.Port = port
+
+	migrationsSource, err := iofs.New(migrationsFS, "testdata/migrations")
+	require.NoError(t, err)
+
+	_, err = dbmigrate.NewLocalMigrator(ctx, migrateConfig, migrationsSource)
+	var connectErr *dbmigrate.ConnectError
+	require.ErrorAs(t, err, &connectErr)
+	assert.Equal(t, dbmigrate.ConnectErrorNetwork, connectErr.Kind)
+	assert.Equal(t, 3, connectErr.Attempts)
+
+	t.Run("overall deadline", func(t *testing.T) {
+		withTimeout := migrateConfig
+		withTimeout.ConnectRetry.MaxAttempts = 1000
+		withTimeout.ConnectRetry.InitialBackoff = 50 * time.Millisecond
+		withTimeout.ConnectRetry.Timeout = 300 * time.Millisecond
+
+		start := time.Now()
+		_, err := dbmigrate.NewLocalMigrator(ctx, withTimeout, migrationsSource)
+		require.ErrorAs(t, err, &connectErr)
+		assert.Equal(t, dbmigrate.ConnectErrorTimeout, connectErr.Kind)
+		assert.Less(t, time.Since(start), 2*time.Second)
+	})
+
+	t.Run("zero backoffs are the defaults", func(t *testing.T) {
+		withZeroBackoff := migrateConfig
+		withZeroBackoff.ConnectRetry = config.ConnectRetryConfig{MaxAttempts: 3}
+
+		start := time.Now()
+		_, err := dbmigrate.NewLocalMigrator(ctx, withZeroBackoff, migrationsSource)
+		require.ErrorAs(t, err, &connectErr)
+		assert.Equal(t, 3, connectErr.Attempts)
+		assert.GreaterOrEqual(t, time.Since(start), 3*config.DefaultConnectInitialBackoff)
+	})
+}
+
+func TestNewLocalMigrator_ConnectErrorKind(t *testing.T) {
+	ctx := context.Background()
+
+	migrationsSource, err := iofs.New(migrationsFS, "testdata/migrations")
+	require.NoError(t, err)
+
+	tests := []struct {
+		scenario string
+		modify   func(pgConfig *config.PostgresDBConfig)
+		expected dbmigrate.ConnectErrorKind
+	}{
+		{"wrong password", func(pgConfig *config.PostgresDBConfig) {
+			wrongPassword := uuid.NewString()
+			pgConfig.Password = &wrongPassword
+		}, dbmigrate.ConnectErrorAuthentication},
+		{"missing database", func(pgConfig *config.PostgresDBConfig) {
+			pgConfig.Database = "missing_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+		}, dbmigrate.ConnectErrorDatabaseMissing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+			require.NoError(t, err)
+			migrateConfig.ConnectRetry.MaxAttempts = 5
+			tt.modify(&migrateConfig.PostgresDB)
+
+			_, err = dbmigrate.NewLocalMigrator(ctx, migrateConfig, migrationsSource)
+			var connectErr *dbmigrate.ConnectError
+			require.ErrorAs(t, err, &connectErr)
+			assert.Equal(t, tt.expected, connectErr.Kind)
+			// not worth retrying
+			assert.Equal(t, 1, connectErr.Attempts)
+		})
+	}
+}
+
+// recordingHooks returns Hooks that record each event they receive, in order, as a string
+func recordingHooks(events *[]string) dbmigrate.Hooks {
+	return dbmigrate.Hooks{
+		BeforeRun: func(_ context.Context, event dbmigrate.RunEvent) {
+			*events = append(*events, fmt.Sprintf("before run %s", event.Operation))
+		},
+		AfterRun: func(_ context.Context, event dbmigrate.RunEvent) {
+			*events = append(*events, fmt.Sprintf("after run %s (failed: %t)", event.Operation, event.Err != nil))
+		},
+		BeforeMigration: func(_ context.Context, event dbmigrate.MigrationEvent) {
+			*events = append(*events, fmt.Sprintf("before %s %d %s", event.Direction, event.Version, event.Identifier))
+		},
+		AfterMigration: func(_ context.Context, event dbmigrate.MigrationEvent) {
+			*events = append(*events, fmt.Sprintf("after %s %d %s", event.Direction, event.Version, event.Identifier))
+		},
+		OnError: func(_ context.Context, event dbmigrate.MigrationEvent) {
+			*events = append(*events, fmt.Sprintf("error %s %d %s", event.Direction, event.Version, event.Identifier))
+		},
+	}
+}
+
+func TestDatabaseMigrator_Hooks(t *testing.T) {
+	ctx := context.Background()
+
+	migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+	require.NoError(t, err)
+
+	t.Run("successful migrations", func(t *testing.T) {
+		migrationsSource, err := iofs.New(migrationsFS, "testdata/migrations")
+		require.NoError(t, err)
+
+		var events []string
+		var elapsed []time.Duration
+		hooks := recordingHooks(&events)
+		migrator, _ := newTestMigrator(ctx, t, migrateConfig, migrationsSource,
+			dbmigrate.WithHooks(hooks),
+			dbmigrate.WithHooks(dbmigrate.Hooks{AfterMigration: func(_ context.Context, event dbmigrate.MigrationEvent) {
+				elapsed = append(elapsed, event.Elapsed)
+			}}),
+		)
+
+		require.NoError(t, migrator.Up())
+		require.NoError(t, migrator.Steps(-1))
+		// no change still counts as a run
+		require.NoError(t, migrator.Migrate(20250319124829))
+
+		assert.Equal(t, []string{
+			"before run up",
+			"before up 20250319124829 create_updated_at_trigger",
+			"after up 20250319124829 create_updated_at_trigger",
+			"before up 20250509172500 create_table",
+			"after up 20250509172500 create_table",
+			"after run up (failed: false)",
+			"before run steps",
+			"before down 20250509172500 create_table",
+			"after down 20250509172500 create_table",
+			"after run steps (failed: false)",
+			"before run migrate",
+			"after run migrate (failed: false)",
+		}, events)
+		require.Len(t, elapsed, 3)
+		for _, e := range elapsed {
+			assert.Positive(t, e)
+		}
+	})
+
+	t.Run("failed migration", func(t *testing.T) {
+		migrationsSource, err := iofs.New(failingMigrationsFS, "testdata/failing_migrations")
+		require.NoError(t, err)
+
+		var events []string
+		migrator, _ := newTestMigrator(ctx, t, migrateConfig, migrationsSource, dbmigrate.WithHooks(recordingHooks(&events)))
+
+		require.Error(t, migrator.Up())
+
+		assert.Equal(t, []string{
+			"before run up",
+			"before up 20250601100000 create_recover_table",
+			"after up 20250601100000 create_recover_table",
+			"before up 20250601110000 alter_recover_table",
+			"error up 20250601110000 alter_recover_table",
+			"after run up (failed: true)",
+		}, events)
+	})
+}
+
+func TestDatabaseMigrator_Telemetry(t *testing.T) {
+	ctx := context.Background()
+
+	migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+	require.NoError(t, err)
+
+	migrationsSource, err := iofs.New(migrationsFS, "testdata/migrations")
+	require.NoError(t, err)
+
+	spanExporter := tracetest.NewInMemoryExporter()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(spanExporter))
+	metricReader := sdkmetric.NewManualReader()
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(metricReader))
+
+	migrator, _ := newTestMigrator(ctx, t, migrateConfig, migrationsSource,
+		dbmigrate.WithTracerProvider(tracerProvider),
+		dbmigrate.WithMeterProvider(meterProvider))
+
+	require.NoError(t, migrator.UpContext(ctx))
+
+	spans := spanExporter.GetSpans()
+	require.Len(t, spans, 3)
+	run := spans[2]
+	assert.Equal(t, "dbmigrate.up", run.Name)
+	for i, expectedVersion := range []int64{20250319124829, 20250509172500} {
+		migrationSpan := spans[i]
+		assert.Equal(t, "dbmigrate.migration", migrationSpan.Name)
+		assert.Equal(t, run.SpanContext.SpanID(), migrationSpan.Parent.SpanID())
+		assert.Contains(t, migrationSpan.Attributes, dbmigrate.VersionKey.Int64(expectedVersion))
+		assert.Contains(t, migrationSpan.Attributes, dbmigrate.DirectionKey.String("up"))
+		assert.Contains(t, migrationSpan.Attributes, dbmigrate.SchemaKey.String(schema))
+		assert.Contains(t, migrationSpan.Attributes, dbmigrate.DBNamespaceKey.String(migrateConfig.PostgresDB.Database))
+	}
+
+	var metrics metricdata.ResourceMetrics
+	require.NoError(t, metricReader.Collect(ctx, &metrics))
+	require.Len(t, metrics.ScopeMetrics, 1)
+	var names []string
+	for _, m := range metrics.ScopeMetrics[0].Metrics {
+		names = append(names, m.Name)
+		if m.Name == "dbmigrate.migration.duration" {
+			histogram := m.Data.(metricdata.Histogram[float64])
+			require.Len(t, histogram.DataPoints, 1)
+			assert.Equal(t, uint64(2), histogram.DataPoints[0].Count)
+		}
+	}
+	assert.ElementsMatch(t, []string{"dbmigrate.migration.duration", "dbmigrate.lock.wait"}, names)
+}
+
+func TestDatabaseMigrator_History(t *testing.T) {
+	ctx := context.Background()
+
+	migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+	require.NoError(t, err)
+
+	fileChecksum := func(t *testing.T, fsys embed.FS, name string) string {
+		t.Helper()
+		body, err := fsys.ReadFile(name)
+		require.NoError(t, err)
+		sum := sha256.Sum256(body)
+		return hex.EncodeToString(sum[:])
+	}
+
+	t.Run("not enabled", func(t *testing.T) {
+		migrationsSource, err := iofs.New(migrationsFS, "testdata/migrations")
+		require.NoError(t, err)
+
+		migrator, _ := newTestMigrator(ctx, t, migrateConfig, migrationsSource)
+		_, err = migrator.History(ctx)
+		require.ErrorIs(t, err, dbmigrate.ErrHistoryNotEnabled)
+	})
+
+	t.Run("successful migrations", func(t *testing.T) {
+		migrationsSource, err := iofs.New(migrationsFS, "testdata/migrations")
+		require.NoError(t, err)
+
+		migrator, _ := newTestMigrator(ctx, t, migrateConfig, migrationsSource, dbmigrate.WithHistory("deploy-42"))
+
+		history, err := migrator.History(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, history)
+
+		started := time.Now()
+		require.NoError(t, migrator.Up())
+		require.NoError(t, migrator.Steps(-1))
+
+		history, err = migrator.History(ctx)
+		require.NoError(t, err)
+		require.Len(t, history, 3)
+
+		expected := []struct {
+			version   uint
+			direction dbmigrate.Direction
+			file      string
+		}{
+			{20250319124829, dbmigrate.DirectionUp, "testdata/migrations/20250319124829_create_updated_at_trigger.up.sql"},
+			{20250509172500, dbmigrate.DirectionUp, "testdata/migrations/20250509172500_create_table.up.sql"},
+			{20250509172500, dbmigrate.DirectionDown, "testdata/migrations/20250509172500_create_table.down.sql"},
+		}
+		for i, e := range expected {
+			entry := history[i]
+			assert.Equal(t, e.version, entry.Version)
+			assert.Equal(t, e.direction, entry.Direction)
+			assert.True(t, entry.Succeeded)
+			assert.Empty(t, entry.Error)
+			assert.Equal(t, migrateConfig.PostgresDB.User, entry.DatabaseUser)
+			assert.Equal(t, "deploy-42", entry.Actor)
+			assert.Equal(t, fileChecksum(t, migrationsFS, e.file), entry.Checksum)
+			assert.WithinDuration(t, started, entry.StartedAt, time.Minute)
+			assert.False(t, entry.FinishedAt.Before(entry.StartedAt))
+			assert.InDelta(t, entry.FinishedAt.Sub(entry.StartedAt), entry.Duration, float64(time.Millisecond))
+		}
+		assert.Equal(t, "create_table", history[2].Identifier)
+	})
+
+	t.Run("failed migration", func(t *testing.T) {
+		migrationsSource, err := iofs.New(failingMigrationsFS, "testdata/failing_migrations")
+		require.NoError(t, err)
+
+		migrator, _ := newTestMigrator(ctx, t, migrateConfig, migrationsSource, dbmigrate.WithHistory(""))
+
+		require.Error(t, migrator.Up())
+
+		history, err := migrator.History(ctx)
+		require.NoError(t, err)
+		require.Len(t, history, 2)
+		assert.True(t, history[0].Succeeded)
+
+		failed := history[1]
+		assert.Equal(t, uint(20250601110000), failed.Version)
+		assert.False(t, failed.Succeeded)
+		assert.Contains(t, failed.Error, "missing_table")
+		assert.Empty(t, failed.Actor)
+		assert.Equal(t, fileChecksum(t, failingMigrationsFS, "testdata/failing_migrations/20250601110000_alter_recover_table.up.sql"), failed.Checksum)
+	})
+}
+
+func TestDatabaseMigrator_Verify(t *testing.T) {
+	ctx := context.Background()
+
+	migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+	require.NoError(t, err)
+
+	applied := fstest.MapFS{
+		"1_create_checksum_table.up.sql":   {Data: []byte("CREATE TABLE checksum_table (id SERIAL PRIMARY KEY);")},
+		"1_create_checksum_table.down.sql": {Data: []byte("DROP TABLE checksum_table;")},
+		"2_add_name.up.sql":                {Data: []byte("ALTER TABLE checksum_table ADD COLUMN name TEXT;")},
+		"2_add_name.down.sql":              {Data: []byte("ALTER TABLE checksum_table DROP COLUMN name;")},
+	}
+	// the first migration has been edited since it was applied, and a third added
+	edited := fstest.MapFS{
+		"1_create_checksum_table.up.sql":   {Data: []byte("CREATE TABLE checksum_table (id BIGSERIAL PRIMARY KEY);")},
+		"1_create_checksum_table.down.sql": applied["1_create_checksum_table.down.sql"],
+		"2_add_name.up.sql":                applied["2_add_name.up.sql"],
+		"2_add_name.down.sql":              applied["2_add_name.down.sql"],
+		"3_add_description.up.sql":         {Data: []byte("ALTER TABLE checksum_table ADD COLUMN description TEXT;")},
+		"3_add_description.down.sql":       {Data: []byte("ALTER TABLE checksum_table DROP COLUMN description;")},
+	}
+	// the second migration has been deleted since it was applied
+	deleted := fstest.MapFS{
+		"1_create_checksum_table.up.sql":   applied["1_create_checksum_table.up.sql"],
+		"1_create_checksum_table.down.sql": applied["1_create_checksum_table.down.sql"],
+	}
+
+	appliedSource, err := iofs.New(applied, ".")
+	require.NoError(t, err)
+	migrator, _ := newTestMigrator(ctx, t, migrateConfig, appliedSource, dbmigrate.WithChecksumMode(config.ChecksumFail))
+	require.NoError(t, migrator.Up())
+	require.NoError(t, migrator.Verify(ctx))
+
+	newMigrator := func(t *testing.T, fsys fstest.MapFS, opts ...dbmigrate.Option) *dbmigrate.DatabaseMigrator {
+		t.Helper()
+		migrationsSource, err := iofs.New(fsys, ".")
+		require.NoError(t, err)
+		m, err := dbmigrate.NewLocalMigrator(ctx, migrateConfig, migrationsSource, opts...)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			dbmigratetest.Close(t, m)
+		})
+		return m
+	}
+
+	t.Run("not enabled", func(t *testing.T) {
+		m := newMigrator(t, edited)
+		require.ErrorIs(t, m.Verify(ctx), dbmigrate.ErrChecksumsNotEnabled)
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		m := newMigrator(t, edited, dbmigrate.WithChecksumMode(config.ChecksumFail))
+
+		err := m.Verify(ctx)
+		var mismatchErr *dbmigrate.ChecksumMismatchError
+		require.ErrorAs(t, err, &mismatchErr)
+		require.Len(t, mismatchErr.Mismatches, 1)
+		assert.Equal(t, dbmigrate.Migration{Version: 1, Identifier: "create_checksum_table"}, mismatchErr.Mismatches[0].Migration)
+		assert.NotEmpty(t, mismatchErr.Mismatches[0].Current)
+		assert.NotEqual(t, mismatchErr.Mismatches[0].Recorded, mismatchErr.Mismatches[0].Current)
+		assert.ErrorContains(t, err, "1_create_checksum_table (changed)")
+
+		require.ErrorAs(t, m.Up(), &mismatchErr)
+		status, err := m.Status(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, uint(2), status.Version)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		m := newMigrator(t, deleted, dbmigrate.WithChecksumMode(config.ChecksumFail))
+
+		var mismatchErr *dbmigrate.ChecksumMismatchError
+		require.ErrorAs(t, m.Verify(ctx), &mismatchErr)
+		require.Len(t, mismatchErr.Mismatches, 1)
+		assert.Equal(t, dbmigrate.Migration{Version: 2, Identifier: "add_name"}, mismatchErr.Mismatches[0].Migration)
+		assert.Empty(t, mismatchErr.Mismatches[0].Current)
+		assert.ErrorContains(t, mismatchErr, "2_add_name (missing)")
+	})
+
+	t.Run("warn", func(t *testing.T) {
+		var logs bytes.Buffer
+		m := newMigrator(t, edited,
+			dbmigrate.WithChecksumMode(config.ChecksumWarn),
+			dbmigrate.WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+
+		require.NoError(t, m.Up())
+		assert.Contains(t, logs.String(), "level=WARN")
+		assert.Contains(t, logs.String(), "1_create_checksum_table (changed)")
+		status, err := m.Status(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, uint(3), status.Version)
+	})
+}
+
+func TestDatabaseMigrator_TransactionDirectives(t *testing.T) {
+	ctx := context.Background()
+
+	migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+	require.NoError(t, err)
+
+	migrations := fstest.MapFS{
+		"1_create_directive_table.up.sql":   {Data: []byte("CREATE TABLE directive_table (id SERIAL PRIMARY KEY, name TEXT);")},
+		"1_create_directive_table.down.sql": {Data: []byte("DROP TABLE directive_table;")},
+		"2_index_name.up.sql": {Data: []byte(`-- dbmigrate:no-transaction
+CREATE INDEX CONCURRENTLY directive_table_name ON directive_table (name);
+CREATE INDEX CONCURRENTLY directive_table_id_name ON directive_table (id, name);`)},
+		"2_index_name.down.sql": {Data: []byte("-- dbmigrate:no-transaction\nDROP INDEX CONCURRENTLY directive_table_name;\nDROP INDEX CONCURRENTLY directive_table_id_name;")},
+		"3_add_columns.up.sql": {Data: []byte(`-- dbmigrate:transaction
+ALTER TABLE directive_table ADD COLUMN description TEXT;
+ALTER TABLE directive_table ADD COLUMN node_id TEXT REFERENCES missing_table (node_id);`)},
+		"3_add_columns.down.sql": {Data: []byte("ALTER TABLE directive_table DROP COLUMN description, DROP COLUMN node_id;")},
+	}
+	migrationsSource, err := iofs.New(migrations, ".")
+	require.NoError(t, err)
+	migrator, verificationConn := newTestMigrator(ctx, t, migrateConfig, migrationsSource)
+
+	err = migrator.Up()
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "in line 3")
+
+	// the indexes were created outside a transaction, and the failed transactional migration was rolled back
+	// leaving the schema clean at the previous version
+	status, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), status.Version)
+	assert.False(t, status.Dirty)
+
+	var indexCount int
+	require.NoError(t, verificationConn.QueryRow(ctx,
+		`SELECT COUNT(*) FROM pg_indexes WHERE schemaname = $1 AND tablename = 'directive_table' AND indexname LIKE 'directive_table_%name'`,
+		schema).Scan(&indexCount))
+	assert.Equal(t, 2, indexCount)
+
+	var columnCount int
+	require.NoError(t, verificationConn.QueryRow(ctx,
+		`SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = $1 AND table_name = 'directive_table' AND column_name = 'description'`,
+		schema).Scan(&columnCount))
+	assert.Zero(t, columnCount)
+
+	require.NoError(t, migrator.Migrate(1))
+}
+
+func TestDatabaseMigrator_GoMigrations(t *testing.T) {
+	ctx := context.Background()
+
+	migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+	require.NoError(t, err)
+
+	migrations := fstest.MapFS{
+		"1_create_go_table.up.sql":    {Data: []byte("CREATE TABLE go_table (id SERIAL PRIMARY KEY, node_id TEXT); INSERT INTO go_table DEFAULT VALUES; INSERT INTO go_table DEFAULT VALUES;")},
+		"1_create_go_table.down.sql":  {Data: []byte("DROP TABLE go_table;")},
+		"3_node_id_not_null.up.sql":   {Data: []byte("ALTER TABLE go_table ALTER COLUMN node_id SET NOT NULL;")},
+		"3_node_id_not_null.down.sql": {Data: []byte("ALTER TABLE go_table ALTER COLUMN node_id DROP NOT NULL;")},
+	}
+	backfill := dbmigrate.GoMigration{
+		Version:    2,
+		Identifier: "backfill_node_ids",
+		Up: func(ctx context.Context, tx pgx.Tx) error {
+			rows, err := tx.Query(ctx, "SELECT id FROM go_table WHERE node_id IS NULL")
+			if err != nil {
+				return err
+			}
+			ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				// the search_path is set to the migration schema
+				if _, err := tx.Exec(ctx, "UPDATE go_table SET node_id = $1 WHERE id = $2", uuid.NewString(), id); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, tx pgx.Tx) error {
+			_, err := tx.Exec(ctx, "UPDATE go_table SET node_id = NULL")
+			return err
+		},
+	}
+	failing := dbmigrate.GoMigration{
+		Version:    4,
+		Identifier: "fail_part_way",
+		Up: func(ctx context.Context, tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, "INSERT INTO go_table (node_id) VALUES ('rolled-back')"); err != nil {
+				return err
+			}
+			return fmt.Errorf("something went wrong")
+		},
+	}
+	migrationsSource, err := iofs.New(migrations, ".")
+	require.NoError(t, err)
+	var events []string
+	migrator, verificationConn := newTestMigrator(ctx, t, migrateConfig, migrationsSource,
+		dbmigrate.WithGoMigrations(backfill, failing),
+		dbmigrate.WithHooks(recordingHooks(&events)))
+
+	err = migrator.Up()
+	require.ErrorContains(t, err, "something went wrong")
+
+	// the failed Go migration was rolled back, leaving the schema clean at the previous version
+	status, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint(3), status.Version)
+	assert.False(t, status.Dirty)
+	assert.Equal(t, []dbmigrate.Migration{
+		{Version: 1, Identifier: "create_go_table"},
+		{Version: 2, Identifier: "backfill_node_ids"},
+		{Version: 3, Identifier: "node_id_not_null"},
+	}, status.Applied)
+	assert.Equal(t, []dbmigrate.Migration{{Version: 4, Identifier: "fail_part_way"}}, status.Pending)
+
+	var nodeIDCount int
+	require.NoError(t, verificationConn.QueryRow(ctx,
+		fmt.Sprintf("SELECT COUNT(DISTINCT node_id) FROM %s.go_table", schema)).Scan(&nodeIDCount))
+	assert.Equal(t, 2, nodeIDCount)
+
+	require.NoError(t, migrator.Migrate(1))
+	require.NoError(t, verificationConn.QueryRow(ctx,
+		fmt.Sprintf("SELECT COUNT(node_id) FROM %s.go_table", schema)).Scan(&nodeIDCount))
+	assert.Zero(t, nodeIDCount)
+	assert.Contains(t, events, "error up 4 fail_part_way")
+	assert.Contains(t, events, "after down 2 backfill_node_ids")
+}
+
+func TestDatabaseMigrator_RecoverGoMigration(t *testing.T) {
+	ctx := context.Background()
+
+	migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+	require.NoError(t, err)
+
+	migrations := fstest.MapFS{
+		"1_create_go_table.up.sql":   {Data: []byte("CREATE TABLE go_table (id SERIAL PRIMARY KEY, node_id TEXT); INSERT INTO go_table DEFAULT VALUES;")},
+		"1_create_go_table.down.sql": {Data: []byte("DROP TABLE go_table;")},
+	}
+	backfill := dbmigrate.GoMigration{
+		Version:    2,
+		Identifier: "backfill_node_ids",
+		Up: func(ctx context.Context, tx pgx.Tx) error {
+			_, err := tx.Exec(ctx, "UPDATE go_table SET node_id = 'backfilled'")
+			return err
+		},
+		Down: func(ctx context.Context, tx pgx.Tx) error {
+			_, err := tx.Exec(ctx, "UPDATE go_table SET node_id = NULL")
+			return err
+		},
+	}
+	migrationsSource, err := iofs.New(migrations, ".")
+	require.NoError(t, err)
+	var events []string
+	migrator, verificationConn := newTestMigrator(ctx, t, migrateConfig, migrationsSource,
+		dbmigrate.WithGoMigrations(backfill),
+		dbmigrate.WithHooks(recordingHooks(&events)))
+
+	require.NoError(t, migrator.Up())
+	// as if the process died while the Go migration was running
+	_, err = verificationConn.Exec(ctx, fmt.Sprintf("UPDATE %s SET dirty = true", pgx.Identifier{schema, "schema_migrations"}.Sanitize()))
+	require.NoError(t, err)
+
+	recovered, err := migrator.Recover(dbmigrate.RecoverRollback)
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), recovered.Version)
+	assert.Equal(t, "backfill_node_ids", recovered.Identifier)
+
+	status, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), status.Version)
+	assert.False(t, status.Dirty)
+
+	// the Go Down ran, rather than the placeholder body of the Go migration being run as SQL
+	var nodeIDCount int
+	require.NoError(t, verificationConn.QueryRow(ctx,
+		fmt.Sprintf("SELECT COUNT(node_id) FROM %s.go_table", schema)).Scan(&nodeIDCount))
+	assert.Zero(t, nodeIDCount)
+	assert.Contains(t, events, "after down 2 backfill_node_ids")
+}
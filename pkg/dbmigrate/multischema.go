@@ -0,0 +1,306 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/pennsieve/dbmigrate-go/pkg/config"
+	"sync"
+	"time"
+)
+
+// defaultSchemaConcurrency is how many schemas a MultiSchemaMigrator migrates at once unless set with WithConcurrency.
+const defaultSchemaConcurrency = 4
+
+// FailurePolicy is what a MultiSchemaMigrator does when migrating a schema fails.
+type FailurePolicy string
+
+const (
+	// StopOnFailure starts no more schemas once one has failed, letting those already started finish.
+	// It is the default.
+	StopOnFailure FailurePolicy = "stop"
+	// ContinueOnFailure migrates every schema whatever happens to the others.
+	ContinueOnFailure FailurePolicy = "continue"
+)
+
+// SchemaSelector returns the schemas a MultiSchemaMigrator migrates, in the order they should be started.
+type SchemaSelector func(ctx context.Context, db *sql.DB) ([]string, error)
+
+// Schemas selects the named schemas, which are created if they do not exist.
+func Schemas(names ...string) SchemaSelector {
+	return func(context.Context, *sql.DB) ([]string, error) {
+		return names, nil
+	}
+}
+
+// SchemasLike selects the existing schemas whose names match pattern, a LIKE pattern such as 'tenant_%'.
+func SchemasLike(pattern string) SchemaSelector {
+	return SchemasFromQuery(`SELECT nspname FROM pg_namespace WHERE nspname LIKE $1 ORDER BY nspname`, pattern)
+}
+
+// SchemasFromQuery selects the schemas named in the first column of the rows returned by query.
+func SchemasFromQuery(query string, args ...any) SchemaSelector {
+	return func(ctx context.Context, db *sql.DB) ([]string, error) {
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("error selecting schemas: %w", err)
+		}
+		var names []string
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return nil, closeOnError(fmt.Errorf("error reading schema name: %w", err), rows)
+			}
+			names = append(names, name)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, closeOnError(fmt.Errorf("error selecting schemas: %w", err), rows)
+		}
+		return names, rows.Close()
+	}
+}
+
+// MultiSchemaOption configures a MultiSchemaMigrator.
+type MultiSchemaOption func(*multiSchemaOptions)
+
+type multiSchemaOptions struct {
+	concurrency     int
+	failurePolicy   FailurePolicy
+	migratorOptions []Option
+}
+
+// WithConcurrency sets how many schemas are migrated at once. Each schema being migrated uses up to
+// two connections from the pool, so if the pool is limited to fewer than twice concurrency connections,
+// only half as many schemas as the limit are migrated at once.
+func WithConcurrency(concurrency int) MultiSchemaOption {
+	return func(o *multiSchemaOptions) {
+		o.concurrency = concurrency
+	}
+}
+
+// WithFailurePolicy sets what happens when migrating a schema fails. The default is StopOnFailure.
+func WithFailurePolicy(policy FailurePolicy) MultiSchemaOption {
+	return func(o *multiSchemaOptions) {
+		o.failurePolicy = policy
+	}
+}
+
+// WithMigratorOptions configures the DatabaseMigrator created for each schema.
+func WithMigratorOptions(opts ...Option) MultiSchemaOption {
+	return func(o *multiSchemaOptions) {
+		o.migratorOptions = append(o.migratorOptions, opts...)
+	}
+}
+
+// SchemaResult is the outcome of migrating one schema.
+type SchemaResult struct {
+	Schema string `json:"schema"`
+	// Status is the state of the schema after the run, or nil if it could not be read.
+	Status *Status `json:"status,omitempty"`
+	// Err is the error migrating the schema, if any.
+	Err error `json:"-"`
+	// Error is the message of Err, for JSON.
+	Error string `json:"error,omitempty"`
+	// Skipped is true if the schema was not migrated because another failed first.
+	Skipped  bool          `json:"skipped"`
+	Duration time.Duration `json:"duration"`
+}
+
+// MultiSchemaReport is the outcome of a MultiSchemaMigrator run.
+type MultiSchemaReport struct {
+	// Results has a result for each selected schema, in the order they were selected.
+	Results []SchemaResult `json:"results"`
+}
+
+// Err returns the errors of the failed schemas joined, or nil if none failed.
+func (r *MultiSchemaReport) Err() error {
+	var errs []error
+	for _, result := range r.Results {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("schema %s: %w", result.Schema, result.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MultiSchemaMigrator applies the same migrations to many schemas, for example a schema per tenant. Each
+// schema gets its own DatabaseMigrator, with its own version table and lock, sharing one connection pool.
+type MultiSchemaMigrator struct {
+	db            *sql.DB
+	closeDB       bool
+	migrateConfig config.Config
+	schemas       SchemaSelector
+	newSource     func() (source.Driver, error)
+	opts          *multiSchemaOptions
+}
+
+// NewRDSProxyMultiSchemaMigrator is NewRDSProxyDatabaseMigrator for the schemas selected by schemas. The schema
+// in migrateConfig is ignored. newSource is called for each schema, since a DatabaseMigrator closes its source.
+func NewRDSProxyMultiSchemaMigrator(migrateConfig config.Config, schemas SchemaSelector, newSource func() (source.Driver, error), awsConfig aws.Config, opts ...MultiSchemaOption) (*MultiSchemaMigrator, error) {
+	pgConfig := migrateConfig.PostgresDB
+	if len(pgConfig.SSLMode) == 0 {
+		pgConfig.SSLMode = rdsDefaultSSLMode
+	}
+	db, err := openDB(
+		datasourceName(pgConfig, ""),
+		stdlib.OptionBeforeConnect(rdsAuthTokenBeforeConnect(awsConfig)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return newMultiSchemaMigrator(db, true, migrateConfig, schemas, newSource, opts), nil
+}
+
+// NewLocalMultiSchemaMigrator is NewLocalMigrator for the schemas selected by schemas. The schema in
+// migrateConfig is ignored. newSource is called for each schema, since a DatabaseMigrator closes its source.
+func NewLocalMultiSchemaMigrator(migrateConfig config.Config, schemas SchemaSelector, newSource func() (source.Driver, error), opts ...MultiSchemaOption) (*MultiSchemaMigrator, error) {
+	if migrateConfig.PostgresDB.Password == nil {
+		return nil, fmt.Errorf("password cannot be nil for local Migrator")
+	}
+	db, err := openDB(datasourceName(migrateConfig.PostgresDB, *migrateConfig.PostgresDB.Password))
+	if err != nil {
+		return nil, err
+	}
+	return newMultiSchemaMigrator(db, true, migrateConfig, schemas, newSource, opts), nil
+}
+
+// NewMultiSchemaMigratorWithDB is NewDatabaseMigratorWithDB for the schemas selected by schemas. Close leaves db open.
+func NewMultiSchemaMigratorWithDB(db *sql.DB, schemas SchemaSelector, newSource func() (source.Driver, error), opts ...MultiSchemaOption) *MultiSchemaMigrator {
+	return newMultiSchemaMigrator(db, false, config.Config{}, schemas, newSource, opts)
+}
+
+func newMultiSchemaMigrator(db *sql.DB, closeDB bool, migrateConfig config.Config, schemas SchemaSelector, newSource func() (source.Driver, error), opts []MultiSchemaOption) *MultiSchemaMigrator {
+	o := &multiSchemaOptions{concurrency: defaultSchemaConcurrency, failurePolicy: StopOnFailure}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &MultiSchemaMigrator{
+		db:            db,
+		closeDB:       closeDB,
+		migrateConfig: migrateConfig,
+		schemas:       schemas,
+		newSource:     newSource,
+		opts:          o,
+	}
+}
+
+// Up applies all pending migrations to each schema. See Run.
+func (m *MultiSchemaMigrator) Up(ctx context.Context) (*MultiSchemaReport, error) {
+	return m.Run(ctx, func(ctx context.Context, migrator *DatabaseMigrator) error {
+		return migrator.UpContext(ctx)
+	})
+}
+
+// Migrate migrates each schema up or down to version. See Run.
+func (m *MultiSchemaMigrator) Migrate(ctx context.Context, version uint) (*MultiSchemaReport, error) {
+	return m.Run(ctx, func(ctx context.Context, migrator *DatabaseMigrator) error {
+		return migrator.MigrateContext(ctx, version)
+	})
+}
+
+// Run selects the schemas and calls run with a DatabaseMigrator for each, running up to the configured
+// concurrency at once. The returned report has a result for every selected schema, and the error is
+// the report's Err, or the error selecting the schemas. If ctx is done no more schemas are started.
+func (m *MultiSchemaMigrator) Run(ctx context.Context, run func(ctx context.Context, migrator *DatabaseMigrator) error) (*MultiSchemaReport, error) {
+	concurrency, err := m.concurrency()
+	if err != nil {
+		return nil, err
+	}
+	schemas, err := m.schemas(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+	report := &MultiSchemaReport{Results: make([]SchemaResult, len(schemas))}
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		stopped bool
+	)
+	slots := make(chan struct{}, concurrency)
+	for i, schema := range schemas {
+		slots <- struct{}{}
+		mu.Lock()
+		skip := stopped
+		mu.Unlock()
+		if skip || ctx.Err() != nil {
+			<-slots
+			report.Results[i] = SchemaResult{Schema: schema, Skipped: true}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			result := m.runSchema(ctx, schema, run)
+			if result.Err != nil && m.opts.failurePolicy != ContinueOnFailure {
+				mu.Lock()
+				stopped = true
+				mu.Unlock()
+			}
+			report.Results[i] = result
+		}()
+	}
+	wg.Wait()
+	return report, report.Err()
+}
+
+// concurrency returns how many schemas can be migrated at once: the configured concurrency, limited so
+// that each schema's DatabaseMigrator can get the minConnections it holds at once from the pool. Otherwise
+// the schemas would each hold one connection while waiting for another that never becomes free.
+func (m *MultiSchemaMigrator) concurrency() (int, error) {
+	concurrency := max(m.opts.concurrency, 1)
+	maxConnections := m.db.Stats().MaxOpenConnections
+	if err := checkMaxConnections(maxConnections); err != nil {
+		return 0, err
+	}
+	if maxConnections > 0 {
+		concurrency = min(concurrency, maxConnections/minConnections)
+	}
+	return concurrency, nil
+}
+
+// runSchema calls run with a new DatabaseMigrator for schema, and reports the schema's status afterwards.
+func (m *MultiSchemaMigrator) runSchema(ctx context.Context, schema string, run func(ctx context.Context, migrator *DatabaseMigrator) error) (result SchemaResult) {
+	result.Schema = schema
+	started := time.Now()
+	defer func() {
+		result.Duration = time.Since(started)
+		if result.Err != nil {
+			result.Error = result.Err.Error()
+		}
+	}()
+	migrationsSource, err := m.newSource()
+	if err != nil {
+		result.Err = fmt.Errorf("error creating migration source: %w", err)
+		return result
+	}
+	migrator, err := newDatabaseMigrator(ctx, m.db, false, schema, migrationsSource, newOptions(m.migrateConfig, m.opts.migratorOptions))
+	if err != nil {
+		result.Err = closeOnError(err, migrationsSource)
+		return result
+	}
+	defer migrator.CloseAndLogError()
+
+	result.Err = run(ctx, migrator)
+	status, err := migrator.Status(context.WithoutCancel(ctx))
+	if err != nil {
+		result.Err = errors.Join(result.Err, fmt.Errorf("error reading status: %w", err))
+		return result
+	}
+	result.Status = status
+	return result
+}
+
+// Close closes the database if the MultiSchemaMigrator opened it.
+func (m *MultiSchemaMigrator) Close() error {
+	if m.closeDB {
+		return m.db.Close()
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package dbmigrate_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5"
+	"github.com/pennsieve/dbmigrate-go/pkg/config"
+	"github.com/pennsieve/dbmigrate-go/pkg/dbmigrate"
+	"github.com/pennsieve/dbmigrate-go/pkg/dbmigratetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/fs"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newMultiSchemaMigrator makes a MultiSchemaMigrator for fsys that drops the tenant schemas when the test completes
+func newMultiSchemaMigrator(ctx context.Context, t *testing.T, fsys fs.FS, dir string, schemas dbmigrate.SchemaSelector, opts ...dbmigrate.MultiSchemaOption) *dbmigrate.MultiSchemaMigrator {
+	t.Helper()
+	migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+	require.NoError(t, err)
+	newSource := func() (source.Driver, error) {
+		return iofs.New(fsys, dir)
+	}
+	migrator, err := dbmigrate.NewLocalMultiSchemaMigrator(migrateConfig, schemas, newSource, opts...)
+	require.NoError(t, err)
+
+	verificationConn, err := dbmigratetest.NewPostgresDBFromConfig(t, migrateConfig.PostgresDB).Connect(ctx, migrateConfig.PostgresDB.Database)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		for _, tenant := range []string{"tenant_a", "tenant_b", "tenant_c"} {
+			_, err := verificationConn.Exec(ctx, "DROP SCHEMA IF EXISTS "+pgx.Identifier{tenant}.Sanitize()+" CASCADE")
+			assert.NoError(t, err)
+		}
+		require.NoError(t, migrator.Close())
+		dbmigratetest.CloseConnection(ctx, t, verificationConn)
+	})
+	return migrator
+}
+
+func TestMultiSchemaMigrator(t *testing.T) {
+	ctx := context.Background()
+
+	migrator := newMultiSchemaMigrator(ctx, t, migrationsFS, "testdata/migrations",
+		dbmigrate.Schemas("tenant_a", "tenant_b", "tenant_c"), dbmigrate.WithConcurrency(2))
+
+	report, err := migrator.Up(ctx)
+	require.NoError(t, err)
+	require.Len(t, report.Results, 3)
+	for i, tenant := range []string{"tenant_a", "tenant_b", "tenant_c"} {
+		result := report.Results[i]
+		assert.Equal(t, tenant, result.Schema)
+		assert.NoError(t, result.Err)
+		assert.False(t, result.Skipped)
+		require.NotNil(t, result.Status)
+		assert.Equal(t, uint(20250509172500), result.Status.Version)
+		assert.Empty(t, result.Status.Pending)
+	}
+
+	// the schemas now exist, so can be discovered
+	discovered := newMultiSchemaMigrator(ctx, t, migrationsFS, "testdata/migrations", dbmigrate.SchemasLike("tenant\\_%"))
+	report, err = discovered.Migrate(ctx, 20250319124829)
+	require.NoError(t, err)
+	var schemas []string
+	for _, result := range report.Results {
+		schemas = append(schemas, result.Schema)
+		require.NotNil(t, result.Status)
+		assert.Equal(t, uint(20250319124829), result.Status.Version)
+	}
+	assert.Equal(t, []string{"tenant_a", "tenant_b", "tenant_c"}, schemas)
+}
+
+func TestMultiSchemaMigrator_FailurePolicy(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		policy          dbmigrate.FailurePolicy
+		expectedSkipped []bool
+	}{
+		{dbmigrate.StopOnFailure, []bool{false, true, true}},
+		{dbmigrate.ContinueOnFailure, []bool{false, false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			migrator := newMultiSchemaMigrator(ctx, t, failingMigrationsFS, "testdata/failing_migrations",
+				dbmigrate.Schemas("tenant_a", "tenant_b", "tenant_c"),
+				dbmigrate.WithConcurrency(1),
+				dbmigrate.WithFailurePolicy(tt.policy))
+
+			report, err := migrator.Up(ctx)
+			require.Error(t, err)
+			assert.ErrorContains(t, err, "schema tenant_a: ")
+			for i, result := range report.Results {
+				assert.Equal(t, tt.expectedSkipped[i], result.Skipped, result.Schema)
+				if result.Skipped {
+					assert.NoError(t, result.Err)
+					assert.Nil(t, result.Status)
+				} else {
+					assert.Error(t, result.Err)
+					assert.NotEmpty(t, result.Error)
+					require.NotNil(t, result.Status, fmt.Sprint(result.Err))
+					assert.True(t, result.Status.Dirty)
+				}
+			}
+		})
+	}
+}
+
+func TestMultiSchemaMigrator_SmallPool(t *testing.T) {
+	ctx := context.Background()
+
+	migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+	require.NoError(t, err)
+	pgConfig := migrateConfig.PostgresDB
+	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s",
+		pgConfig.Host, pgConfig.Port, pgConfig.User, *pgConfig.Password, pgConfig.Database)
+	newSource := func() (source.Driver, error) {
+		return iofs.New(migrationsFS, "testdata/migrations")
+	}
+	tenants := dbmigrate.Schemas("tenant_a", "tenant_b", "tenant_c")
+
+	t.Run("fewer connections than concurrency needs", func(t *testing.T) {
+		db, err := sql.Open("pgx", dsn)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			for _, tenant := range []string{"tenant_a", "tenant_b", "tenant_c"} {
+				_, err := db.ExecContext(ctx, "DROP SCHEMA IF EXISTS "+pgx.Identifier{tenant}.Sanitize()+" CASCADE")
+				assert.NoError(t, err)
+			}
+			require.NoError(t, db.Close())
+		})
+		// four schemas at once would need eight connections, and would each hold one waiting for another
+		db.SetMaxOpenConns(3)
+		migrator := dbmigrate.NewMultiSchemaMigratorWithDB(db, tenants, newSource, dbmigrate.WithConcurrency(4))
+
+		runCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		defer cancel()
+		report, err := migrator.Up(runCtx)
+		require.NoError(t, err)
+		for _, result := range report.Results {
+			require.NotNil(t, result.Status, result.Schema)
+			assert.Equal(t, uint(20250509172500), result.Status.Version)
+		}
+	})
+
+	t.Run("too few connections for one schema", func(t *testing.T) {
+		// the limit is checked before connecting
+		db, err := sql.Open("pgx", "host=localhost port=5432 user=postgres dbname=postgres")
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			require.NoError(t, db.Close())
+		})
+		db.SetMaxOpenConns(1)
+		migrator := dbmigrate.NewMultiSchemaMigratorWithDB(db, tenants, newSource)
+
+		_, err = migrator.Up(ctx)
+		require.ErrorIs(t, err, dbmigrate.ErrTooFewConnections)
+	})
+}
+
+// closeCountingSource counts how many times it is closed
+type closeCountingSource struct {
+	source.Driver
+	closed *atomic.Int32
+}
+
+func (s closeCountingSource) Close() error {
+	s.closed.Add(1)
+	return s.Driver.Close()
+}
+
+func TestMultiSchemaMigrator_ClosesSourceOnError(t *testing.T) {
+	ctx := context.Background()
+
+	// nothing listens on port 1, so creating each schema's DatabaseMigrator fails
+	db, err := sql.Open("pgx", "host=localhost port=1 user=postgres dbname=postgres")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, db.Close())
+	})
+	var closed atomic.Int32
+	newSource := func() (source.Driver, error) {
+		migrationsSource, err := iofs.New(migrationsFS, "testdata/migrations")
+		return closeCountingSource{Driver: migrationsSource, closed: &closed}, err
+	}
+	migrator := dbmigrate.NewMultiSchemaMigratorWithDB(db, dbmigrate.Schemas("tenant_a", "tenant_b"), newSource,
+		dbmigrate.WithFailurePolicy(dbmigrate.ContinueOnFailure),
+		dbmigrate.WithMigratorOptions(dbmigrate.WithConnectRetry(config.ConnectRetryConfig{MaxAttempts: 1})))
+
+	report, err := migrator.Up(ctx)
+	require.Error(t, err)
+	require.Len(t, report.Results, 2)
+	assert.Equal(t, int32(2), closed.Load())
+}
@@ -0,0 +1,116 @@
+package dbmigrate
+
+import (
+	"github.com/pennsieve/dbmigrate-go/pkg/config"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+)
+
+// Option configures a DatabaseMigrator when passed to one of its constructors.
+type Option func(*options)
+
+type options struct {
+	migration      config.MigrationConfig
+	connectRetry   config.ConnectRetryConfig
+	verboseLogging bool
+	logger         *slog.Logger
+	hooks          hookList
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+	goMigrations   []GoMigration
+}
+
+// newOptions returns the options from migrateConfig, overridden by opts.
+func newOptions(migrateConfig config.Config, opts []Option) *options {
+	o := &options{
+		migration:      migrateConfig.Migration,
+		connectRetry:   migrateConfig.ConnectRetry,
+		verboseLogging: migrateConfig.VerboseLogging,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithMigrationConfig sets the floor version and timeouts used by the DatabaseMigrator.
+func WithMigrationConfig(migrationConfig config.MigrationConfig) Option {
+	return func(o *options) {
+		o.migration = migrationConfig
+	}
+}
+
+// WithVerboseLogging turns golang-migrate's verbose logging on or off.
+func WithVerboseLogging(verboseLogging bool) Option {
+	return func(o *options) {
+		o.verboseLogging = verboseLogging
+	}
+}
+
+// WithConnectRetry sets how the DatabaseMigrator retries connecting to a database that is not yet ready.
+func WithConnectRetry(connectRetryConfig config.ConnectRetryConfig) Option {
+	return func(o *options) {
+		o.connectRetry = connectRetryConfig
+	}
+}
+
+// WithLogger sends the DatabaseMigrator's and golang-migrate's log messages to logger instead of
+// the standard library's log package. Messages about individual migrations include their version,
+// direction and duration, and every message includes the schema. golang-migrate's verbose
+// messages are logged at info level if verbose logging is on, and otherwise at debug level, so that
+// they can be turned on with the logger's level instead.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithHooks registers functions to be called before and after each run and each migration.
+// It may be used more than once, in which case hooks are called in the order they were registered.
+func WithHooks(hooks Hooks) Option {
+	return func(o *options) {
+		o.hooks = append(o.hooks, hooks)
+	}
+}
+
+// WithTracerProvider creates a span for each run of Up, Migrate, Steps or Down using tracerProvider,
+// with a child span for each migration. The spans are children of any span in the run's context.
+func WithTracerProvider(tracerProvider trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracerProvider = tracerProvider
+	}
+}
+
+// WithMeterProvider records the duration of each migration, the time spent waiting for the
+// migration lock, and the number of failed migrations and runs using meterProvider.
+func WithMeterProvider(meterProvider metric.MeterProvider) Option {
+	return func(o *options) {
+		o.meterProvider = meterProvider
+	}
+}
+
+// WithHistory turns on the audit history table, which records every migration run along with actor,
+// an optional actor or deployment ID such as a CI job URL. See DatabaseMigrator.History.
+func WithHistory(actor string) Option {
+	return func(o *options) {
+		o.migration.History = true
+		o.migration.Actor = actor
+	}
+}
+
+// WithChecksumMode sets whether the checksums of applied migrations are recorded, and whether Up fails
+// or only logs a warning if an applied migration file has changed. See DatabaseMigrator.Verify.
+func WithChecksumMode(mode config.ChecksumMode) Option {
+	return func(o *options) {
+		o.migration.ChecksumMode = mode
+	}
+}
+
+// WithGoMigrations adds migrations written in Go to those from the source.Driver. It may be used more than
+// once. See GoMigration.
+func WithGoMigrations(migrations ...GoMigration) Option {
+	return func(o *options) {
+		o.goMigrations = append(o.goMigrations, migrations...)
+	}
+}
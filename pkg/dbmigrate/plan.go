@@ -0,0 +1,152 @@
+package dbmigrate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4"
+	"io"
+	"os"
+	"strings"
+)
+
+// MigrationPlan lists the migrations that Up or Migrate would run, in the order they would run.
+type MigrationPlan struct {
+	// FromVersion is the currently applied version. Only meaningful if HasFromVersion is true.
+	FromVersion    uint `json:"fromVersion"`
+	HasFromVersion bool `json:"hasFromVersion"`
+	// TargetVersion is the version the schema would be at after the plan is run.
+	TargetVersion uint       `json:"targetVersion"`
+	Steps         []PlanStep `json:"steps"`
+}
+
+// PlanStep is a single migration in a MigrationPlan.
+type PlanStep struct {
+	Migration
+	Direction Direction `json:"direction"`
+	// SQL is the body of the migration file. It is empty if the source has no file for this
+	// version in this direction, in which case only the recorded version is changed.
+	SQL string `json:"sql"`
+}
+
+// PlanUp returns the plan that Up would run. Nothing is executed.
+func (m *DatabaseMigrator) PlanUp() (*MigrationPlan, error) {
+	migrations, err := sourceMigrations(m.source)
+	if err != nil {
+		return nil, err
+	}
+	if len(migrations) == 0 {
+		return nil, fmt.Errorf("no migrations found in source: %w", os.ErrNotExist)
+	}
+	return m.plan(migrations, migrations[len(migrations)-1].Version)
+}
+
+// Plan returns the plan that Migrate(targetVersion) would run. Nothing is executed.
+func (m *DatabaseMigrator) Plan(targetVersion uint) (*MigrationPlan, error) {
+	migrations, err := sourceMigrations(m.source)
+	if err != nil {
+		return nil, err
+	}
+	return m.plan(migrations, targetVersion)
+}
+
+func (m *DatabaseMigrator) plan(migrations []Migration, targetVersion uint) (*MigrationPlan, error) {
+	plan := &MigrationPlan{TargetVersion: targetVersion, Steps: []PlanStep{}}
+	version, dirty, err := m.wrapped.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return nil, err
+	}
+	if err == nil {
+		if dirty {
+			return nil, migrate.ErrDirty{Version: int(version)}
+		}
+		plan.FromVersion = version
+		plan.HasFromVersion = true
+	}
+
+	if plan.HasFromVersion && migrationIndex(migrations, plan.FromVersion) < 0 {
+		return nil, fmt.Errorf("no migration found for current version %d: %w", plan.FromVersion, os.ErrNotExist)
+	}
+	targetIndex := migrationIndex(migrations, targetVersion)
+	if targetIndex < 0 {
+		return nil, fmt.Errorf("no migration found for version %d: %w", targetVersion, os.ErrNotExist)
+	}
+	if !plan.HasFromVersion || plan.FromVersion < targetVersion {
+		for _, migration := range migrations[:targetIndex+1] {
+			if !plan.HasFromVersion || migration.Version > plan.FromVersion {
+				if err := plan.addStep(m, migration, DirectionUp); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return plan, nil
+	}
+	for i := len(migrations) - 1; i > targetIndex; i-- {
+		if migrations[i].Version <= plan.FromVersion {
+			if err := plan.addStep(m, migrations[i], DirectionDown); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return plan, nil
+}
+
+func (p *MigrationPlan) addStep(m *DatabaseMigrator, migration Migration, direction Direction) error {
+	step := PlanStep{Migration: migration, Direction: direction}
+	body, identifier, err := readMigration(m.source, migration.Version, direction)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		step.Identifier = identifier
+		step.SQL = string(body)
+	}
+	p.Steps = append(p.Steps, step)
+	return nil
+}
+
+func migrationIndex(migrations []Migration, version uint) int {
+	for i, migration := range migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// JSON renders the plan as indented JSON.
+func (p *MigrationPlan) JSON() ([]byte, error) {
+	return json.MarshalIndent(p, "", "  ")
+}
+
+// WriteText renders the plan as human-readable text, including the SQL of each step.
+func (p *MigrationPlan) WriteText(w io.Writer) error {
+	from := "none"
+	if p.HasFromVersion {
+		from = fmt.Sprintf("%d", p.FromVersion)
+	}
+	if _, err := fmt.Fprintf(w, "Migration plan: %s -> %d (%d migrations)\n", from, p.TargetVersion, len(p.Steps)); err != nil {
+		return err
+	}
+	for i, step := range p.Steps {
+		if _, err := fmt.Fprintf(w, "\n-- [%d/%d] %s %d %s\n", i+1, len(p.Steps), step.Direction, step.Version, step.Identifier); err != nil {
+			return err
+		}
+		body := strings.TrimRight(step.SQL, "\n")
+		if len(body) == 0 {
+			body = "-- no migration file; only the recorded version changes"
+		}
+		if _, err := fmt.Fprintln(w, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// String returns the text rendering of the plan.
+func (p *MigrationPlan) String() string {
+	var b strings.Builder
+	// strings.Builder never returns write errors
+	_ = p.WriteText(&b)
+	return b.String()
+}
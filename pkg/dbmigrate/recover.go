@@ -0,0 +1,159 @@
+package dbmigrate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"os"
+)
+
+// ErrNotDirty is returned by Recover if there is no failed migration to recover from.
+var ErrNotDirty = errors.New("schema is not dirty")
+
+// RecoveryAction is the way Recover resolves a dirty schema.
+type RecoveryAction string
+
+const (
+	// RecoverMarkClean marks the dirty version clean, leaving the schema as the failed
+	// migration left it. Use when the failed migration has been completed or reverted by hand.
+	RecoverMarkClean RecoveryAction = "mark-clean"
+	// RecoverRollback runs the down migration of the dirty version and then marks the
+	// previous version clean.
+	RecoverRollback RecoveryAction = "rollback"
+)
+
+// DirtyState describes a migration that failed part way through and left the schema dirty.
+type DirtyState struct {
+	// Version is the version recorded as dirty.
+	Version uint `json:"version"`
+	// Identifier identifies the migration file for Version that failed.
+	Identifier string `json:"identifier"`
+	// PreviousVersion is the version before Version in the source. Only meaningful if HasPreviousVersion is true.
+	PreviousVersion    uint `json:"previousVersion"`
+	HasPreviousVersion bool `json:"hasPreviousVersion"`
+}
+
+func (s *DirtyState) String() string {
+	return fmt.Sprintf("migration %d (%s) failed and left the schema dirty", s.Version, s.Identifier)
+}
+
+// Force sets the recorded migration version and marks it clean without running any migrations.
+// Use version -1 to record that no migrations have been applied.
+func (m *DatabaseMigrator) Force(version int) error {
+	m.wrapped.Log.Printf("forcing version %d", version)
+	if err := m.wrapped.Force(version); err != nil {
+		return fmt.Errorf("error forcing version %d: %w", version, err)
+	}
+	return nil
+}
+
+// DirtyState returns the failed migration if the schema is dirty, or nil if it is not.
+func (m *DatabaseMigrator) DirtyState() (*DirtyState, error) {
+	version, dirty, err := m.wrapped.Version()
+	if err != nil {
+		if errors.Is(err, migrate.ErrNilVersion) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !dirty {
+		return nil, nil
+	}
+	state := &DirtyState{Version: version}
+	if identifier, err := sourceIdentifier(m.source, version); err == nil {
+		state.Identifier = identifier
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	previous, err := m.source.Prev(version)
+	if err == nil {
+		state.PreviousVersion = previous
+		state.HasPreviousVersion = true
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error reading previous version of %d from source: %w", version, err)
+	}
+	return state, nil
+}
+
+// Recover resolves a dirty schema using the given action and returns the state it recovered from.
+// Returns ErrNotDirty if there is nothing to recover from, including when a concurrent Recover
+// rolled back the dirty version first.
+func (m *DatabaseMigrator) Recover(action RecoveryAction) (*DirtyState, error) {
+	state, err := m.DirtyState()
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, ErrNotDirty
+	}
+	m.wrapped.Log.Printf("recovering: %s", state)
+	switch action {
+	case RecoverMarkClean:
+		if err := m.Force(int(state.Version)); err != nil {
+			return nil, err
+		}
+	case RecoverRollback:
+		if err := m.rollbackDirty(state); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown recovery action %q", action)
+	}
+	m.wrapped.Log.Printf("recovered from dirty version %d using %s", state.Version, action)
+	return state, nil
+}
+
+// rollbackDirty runs the down migration for the dirty version and records the previous version as clean.
+// The down migration is run as a migration step, so the hooks, telemetry and history table record it as
+// they would one run by Down. If it fails in a transaction that is rolled back, the version stays dirty.
+func (m *DatabaseMigrator) rollbackDirty(state *DirtyState) error {
+	body, identifier, err := readMigration(m.source, state.Version, DirectionDown)
+	if err != nil {
+		return err
+	}
+	previousVersion := database.NilVersion
+	if state.HasPreviousVersion {
+		previousVersion = int(state.PreviousVersion)
+	}
+	return m.run(context.Background(), "recover", func() error {
+		if err := m.database.Lock(); err != nil {
+			return fmt.Errorf("error acquiring lock for rollback: %w", err)
+		}
+		// another Recover may have resolved the dirty version while this one waited for the lock
+		version, dirty, err := m.database.Version()
+		if err != nil {
+			return m.unlockOnError(err)
+		}
+		if !dirty || version != int(state.Version) {
+			return m.unlockOnError(fmt.Errorf("%w: dirty version %d was recovered while waiting for the lock", ErrNotDirty, state.Version))
+		}
+		m.wrapped.Log.Printf("running down migration %d (%s)", state.Version, identifier)
+		m.database.startStep(&migrationStep{
+			targetVersion:   previousVersion,
+			previousVersion: int(state.Version),
+			previousDirty:   true,
+			event:           MigrationEvent{Version: state.Version, Direction: DirectionDown, Identifier: identifier},
+		})
+		if err := m.database.Run(bytes.NewReader(body)); err != nil {
+			return m.unlockOnError(fmt.Errorf("error running down migration %d (%s): %w", state.Version, identifier, err))
+		}
+		m.wrapped.Log.Printf("marking version %d clean", previousVersion)
+		if err := m.database.SetVersion(previousVersion, false); err != nil {
+			return m.unlockOnError(fmt.Errorf("error setting version %d: %w", previousVersion, err))
+		}
+		if err := m.database.Unlock(); err != nil {
+			return fmt.Errorf("error releasing lock after rollback: %w", err)
+		}
+		return nil
+	})
+}
+
+func (m *DatabaseMigrator) unlockOnError(originalErr error) error {
+	if unlockErr := m.database.Unlock(); unlockErr != nil {
+		return fmt.Errorf("%w; in addition an error occured when releasing lock: %v", originalErr, unlockErr)
+	}
+	return originalErr
+}
@@ -0,0 +1,138 @@
+package dbmigrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ReversibilityResult is the outcome of checking that one migration's down migration reverses its up.
+type ReversibilityResult struct {
+	Migration
+	// NoDown is true if the source has no down migration for the version, so it could not be checked.
+	NoDown bool `json:"noDown"`
+	// Differences are how the schema after the down migration differs from the schema before the up.
+	Differences []CatalogDifference `json:"differences"`
+	// ReapplyDifferences are how the schema after applying the up migration again differs from the schema
+	// after it was first applied, which happens when the down migration leaves something behind that
+	// changes what the up does.
+	ReapplyDifferences []CatalogDifference `json:"reapplyDifferences"`
+}
+
+// Reversible is true if the down migration restored the schema and the up migration could be applied again.
+func (r ReversibilityResult) Reversible() bool {
+	return !r.NoDown && len(r.Differences) == 0 && len(r.ReapplyDifferences) == 0
+}
+
+func (r ReversibilityResult) String() string {
+	name := fmt.Sprintf("%d_%s", r.Version, r.Identifier)
+	if r.NoDown {
+		return fmt.Sprintf("%s has no down migration", name)
+	}
+	if r.Reversible() {
+		return fmt.Sprintf("%s is reversible", name)
+	}
+	var message string
+	if len(r.Differences) > 0 {
+		message = fmt.Sprintf("%s: down migration does not restore the schema:\n%s", name, formatDifferences(r.Differences, "  "))
+	}
+	if len(r.ReapplyDifferences) > 0 {
+		if len(message) > 0 {
+			message += "\n"
+		}
+		message += fmt.Sprintf("%s: up migration has a different result when applied again:\n%s", name, formatDifferences(r.ReapplyDifferences, "  "))
+	}
+	return message
+}
+
+// ReversibilityReport is the outcome of VerifyReversible.
+type ReversibilityReport struct {
+	// Results has a result for each migration checked, in version order.
+	Results []ReversibilityResult `json:"results"`
+}
+
+// Err returns an error describing the migrations that are not reversible, or nil if they all are.
+func (r *ReversibilityReport) Err() error {
+	var errs []error
+	for _, result := range r.Results {
+		if !result.Reversible() {
+			errs = append(errs, errors.New(result.String()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// VerifyReversible checks that each pending migration's down migration reverses its up migration. One
+// migration at a time, it applies the up, rolls it back with the down and compares the schema's tables,
+// columns, types, indexes, constraints, functions and triggers with those before the up, then applies
+// the up again and compares with the first time. The schema is left fully migrated.
+//
+// Since it rolls back every migration it applies, VerifyReversible is meant for a throwaway schema in a
+// test, starting empty, rather than for a schema in use. Data is not compared, only the catalog.
+//
+// The returned error is for a migration that failed to run, in which case the last result of the report is
+// for that migration, with any differences found before it failed. An up migration that fails when applied
+// again is usually one whose down left something behind. Migrations that ran but are not reversible are
+// reported by the report's Err.
+func (m *DatabaseMigrator) VerifyReversible(ctx context.Context) (*ReversibilityReport, error) {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if status.Dirty {
+		return nil, fmt.Errorf("cannot verify migrations of a dirty schema at version %d", status.Version)
+	}
+	report := &ReversibilityReport{Results: []ReversibilityResult{}}
+	for _, migration := range status.Pending {
+		result, err := m.verifyReversible(ctx, migration)
+		report.Results = append(report.Results, result)
+		if err != nil {
+			return report, fmt.Errorf("error verifying migration %d_%s: %w", migration.Version, migration.Identifier, err)
+		}
+	}
+	return report, nil
+}
+
+// verifyReversible applies migration, the next pending one, and checks that it is reversible.
+func (m *DatabaseMigrator) verifyReversible(ctx context.Context, migration Migration) (ReversibilityResult, error) {
+	result := ReversibilityResult{Migration: migration}
+	before, err := m.snapshotCatalog(ctx, m.database.schemaName)
+	if err != nil {
+		return result, err
+	}
+	if err := m.StepsContext(ctx, 1); err != nil {
+		return result, err
+	}
+	downIdentifier, err := directionIdentifier(m.source, migration.Version, DirectionDown)
+	if err != nil {
+		return result, err
+	}
+	if len(downIdentifier) == 0 {
+		// golang-migrate would only change the version
+		result.NoDown = true
+		return result, nil
+	}
+	afterUp, err := m.snapshotCatalog(ctx, m.database.schemaName)
+	if err != nil {
+		return result, err
+	}
+
+	if err := m.StepsContext(ctx, -1); err != nil {
+		return result, err
+	}
+	afterDown, err := m.snapshotCatalog(ctx, m.database.schemaName)
+	if err != nil {
+		return result, err
+	}
+	result.Differences = diffCatalogs(before, afterDown)
+
+	if err := m.StepsContext(ctx, 1); err != nil {
+		return result, err
+	}
+	reapplied, err := m.snapshotCatalog(ctx, m.database.schemaName)
+	if err != nil {
+		return result, err
+	}
+	result.ReapplyDifferences = diffCatalogs(afterUp, reapplied)
+	return result, nil
+}
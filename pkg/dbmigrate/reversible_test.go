@@ -0,0 +1,83 @@
+package dbmigrate_test
+
+import (
+	"context"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/pennsieve/dbmigrate-go/pkg/config"
+	"github.com/pennsieve/dbmigrate-go/pkg/dbmigrate"
+	"github.com/pennsieve/dbmigrate-go/pkg/dbmigratetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDatabaseMigrator_VerifyReversible(t *testing.T) {
+	ctx := context.Background()
+
+	migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+	require.NoError(t, err)
+
+	migrationsSource, err := iofs.New(migrationsFS, "testdata/migrations")
+	require.NoError(t, err)
+	migrator, _ := newTestMigrator(ctx, t, migrateConfig, migrationsSource)
+
+	report, err := migrator.VerifyReversible(ctx)
+	require.NoError(t, err)
+	require.NoError(t, report.Err())
+	require.Len(t, report.Results, 2)
+	for _, result := range report.Results {
+		assert.True(t, result.Reversible(), result.String())
+	}
+
+	// the schema is left fully migrated
+	status, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, status.Pending)
+}
+
+func TestDatabaseMigrator_VerifyReversible_Asymmetric(t *testing.T) {
+	ctx := context.Background()
+
+	migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+	require.NoError(t, err)
+
+	migrations := fstest.MapFS{
+		"1_create_table.up.sql":   sqlFile("CREATE TYPE reversible_kind AS ENUM ('a', 'b'); CREATE TABLE reversible (id INT PRIMARY KEY, kind reversible_kind);"),
+		"1_create_table.down.sql": sqlFile("DROP TABLE reversible; DROP TYPE reversible_kind;"),
+		// the down forgets the column
+		"2_add_column.up.sql":   sqlFile("ALTER TABLE reversible ADD COLUMN IF NOT EXISTS name TEXT NOT NULL DEFAULT ''; CREATE INDEX reversible_name ON reversible (name);"),
+		"2_add_column.down.sql": sqlFile("DROP INDEX reversible_name;"),
+		"3_no_down.up.sql":      sqlFile("CREATE TABLE reversible_other (id INT);"),
+		// the down leaves the column behind
+		"4_add_other_column.up.sql":   sqlFile("ALTER TABLE reversible_other ADD COLUMN IF NOT EXISTS name TEXT; ALTER TABLE reversible_other ALTER COLUMN id SET NOT NULL;"),
+		"4_add_other_column.down.sql": sqlFile("ALTER TABLE reversible_other ALTER COLUMN id DROP NOT NULL;"),
+	}
+	migrationsSource, err := iofs.New(migrations, ".")
+	require.NoError(t, err)
+	migrator, _ := newTestMigrator(ctx, t, migrateConfig, migrationsSource)
+
+	report, err := migrator.VerifyReversible(ctx)
+	require.NoError(t, err)
+	require.Len(t, report.Results, 4)
+
+	assert.True(t, report.Results[0].Reversible(), report.Results[0].String())
+
+	assert.False(t, report.Results[1].Reversible())
+	assert.Equal(t, []dbmigrate.CatalogDifference{
+		{Kind: "column", Name: "reversible.name", Actual: "text NOT NULL DEFAULT ''::text"},
+	}, report.Results[1].Differences)
+	assert.Empty(t, report.Results[1].ReapplyDifferences)
+
+	assert.True(t, report.Results[2].NoDown)
+
+	assert.False(t, report.Results[3].Reversible())
+	assert.Equal(t, []dbmigrate.CatalogDifference{
+		{Kind: "column", Name: "reversible_other.name", Actual: "text"},
+	}, report.Results[3].Differences)
+
+	err = report.Err()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "2_add_column: down migration does not restore the schema:\n  unexpected column reversible.name: text NOT NULL DEFAULT ''::text")
+	assert.Contains(t, err.Error(), "3_no_down has no down migration")
+}
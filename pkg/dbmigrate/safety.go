@@ -0,0 +1,215 @@
+package dbmigrate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Rules for statements in up migrations that lock or rewrite live tables. Statements on a table created
+// earlier in the same file are not reported, since the table is still empty. Down migrations are not checked.
+//
+// A finding can be suppressed with a comment naming the rules to ignore, on the line before the statement,
+// inside it, or at the end of its last line:
+//
+//	-- dbmigrate:ignore index-not-concurrent
+//	CREATE INDEX users_email ON users (email);
+//
+// A directive without rules ignores every rule for that statement.
+const (
+	// RuleVolatileDefault is ADD COLUMN with a volatile default, such as random() or a serial type, which
+	// rewrites the table.
+	RuleVolatileDefault LintRule = "volatile-default"
+	// RuleIndexNotConcurrent is CREATE INDEX without CONCURRENTLY, which blocks writes while the index is built.
+	RuleIndexNotConcurrent LintRule = "index-not-concurrent"
+	// RuleColumnType is ALTER COLUMN ... TYPE, which usually rewrites the table.
+	RuleColumnType LintRule = "column-type"
+	// RuleDropColumn is DROP COLUMN, which breaks code still using the column.
+	RuleDropColumn LintRule = "drop-column"
+	// RuleNotNull is SET NOT NULL, or a CHECK (... IS NOT NULL) constraint without NOT VALID, either of which
+	// scans the table while holding an ACCESS EXCLUSIVE lock.
+	RuleNotNull LintRule = "not-null"
+	// RuleRename is renaming a table or column, which breaks code still using the old name.
+	RuleRename LintRule = "rename"
+)
+
+// ignoreDirective starts a comment that suppresses findings for a statement.
+const ignoreDirective = "dbmigrate:ignore"
+
+var (
+	createTablePattern  = regexp.MustCompile(`(?i)^CREATE (?:(?:GLOBAL |LOCAL )?(?:TEMP |TEMPORARY |UNLOGGED ))?TABLE (?:IF NOT EXISTS )?([^\s(]+)`)
+	createIndexPattern  = regexp.MustCompile(`(?i)^CREATE (?:UNIQUE )?INDEX (CONCURRENTLY )?(?:IF NOT EXISTS )?(?:[^\s(]+ )?ON (?:ONLY )?([^\s(]+)`)
+	alterTablePattern   = regexp.MustCompile(`(?i)^ALTER TABLE (?:IF EXISTS )?(?:ONLY )?([^\s(]+) (.+)$`)
+	addColumnPattern    = regexp.MustCompile(`(?i)^ADD (?:COLUMN )?(?:IF NOT EXISTS )?([^\s(]+) (.*)$`)
+	volatilePattern     = regexp.MustCompile(`(?i)\b(?:SMALLSERIAL|SERIAL|BIGSERIAL|SERIAL[248]|AS IDENTITY)\b|\bDEFAULT\b.*\b(?:RANDOM|CLOCK_TIMESTAMP|TIMEOFDAY|GEN_RANDOM_UUID|UUID_GENERATE_V1|UUID_GENERATE_V1MC|UUID_GENERATE_V4|NEXTVAL) ?\(`)
+	addCheckPattern     = regexp.MustCompile(`(?i)^ADD (?:CONSTRAINT [^\s(]+ )?CHECK ?\(.*\bIS NOT NULL\b`)
+	notValidPattern     = regexp.MustCompile(`(?i)\bNOT VALID\b`)
+	columnTypePattern   = regexp.MustCompile(`(?i)^ALTER (?:COLUMN )?([^\s(]+) (?:SET DATA )?TYPE\b`)
+	setNotNullPattern   = regexp.MustCompile(`(?i)^ALTER (?:COLUMN )?([^\s(]+) SET NOT NULL\b`)
+	dropColumnPattern   = regexp.MustCompile(`(?i)^DROP (?:COLUMN )?(?:IF EXISTS )?([^\s(]+)`)
+	renamePattern       = regexp.MustCompile(`(?i)^RENAME (?:(CONSTRAINT) |COLUMN )?`)
+	addConstraintTokens = map[string]bool{"CONSTRAINT": true, "PRIMARY": true, "UNIQUE": true, "CHECK": true, "FOREIGN": true, "EXCLUDE": true}
+)
+
+// hazard is a dangerous operation found in a statement.
+type hazard struct {
+	rule       LintRule
+	table      string
+	message    string
+	suggestion string
+}
+
+// checkSQL reports the hazards in the statements of an up migration file.
+func (l *linter) checkSQL(version uint, file lintFile) {
+	created := map[string]bool{}
+	for _, statement := range splitStatements(file.body) {
+		if matches := createTablePattern.FindStringSubmatch(statement.text); matches != nil {
+			created[tableKey(matches[1])] = true
+			continue
+		}
+		for _, h := range statementHazards(statement.text) {
+			if created[tableKey(h.table)] || statement.ignores(h.rule) {
+				continue
+			}
+			l.add(LintFinding{
+				Rule:       h.rule,
+				Version:    version,
+				Files:      []string{file.name},
+				Line:       statement.line,
+				Message:    h.message,
+				Suggestion: h.suggestion,
+			})
+		}
+	}
+}
+
+// statementHazards returns the hazards in a single statement.
+func statementHazards(text string) []hazard {
+	if matches := createIndexPattern.FindStringSubmatch(text); matches != nil {
+		if matches[1] != "" {
+			return nil
+		}
+		return []hazard{{
+			rule:       RuleIndexNotConcurrent,
+			table:      matches[2],
+			message:    fmt.Sprintf("CREATE INDEX without CONCURRENTLY blocks writes to %s until the index is built", matches[2]),
+			suggestion: "use CREATE INDEX CONCURRENTLY in a file marked -- " + noTransactionDirective + ", since it cannot run inside a transaction",
+		}}
+	}
+	matches := alterTablePattern.FindStringSubmatch(text)
+	if matches == nil {
+		return nil
+	}
+	table := matches[1]
+	var hazards []hazard
+	for _, action := range splitTopLevel(matches[2]) {
+		if h, ok := actionHazard(table, action); ok {
+			hazards = append(hazards, h)
+		}
+	}
+	return hazards
+}
+
+// actionHazard returns the hazard in a single action of an ALTER TABLE statement, if any.
+func actionHazard(table, action string) (hazard, bool) {
+	if matches := addColumnPattern.FindStringSubmatch(action); matches != nil && !addConstraintTokens[strings.ToUpper(matches[1])] {
+		if volatilePattern.MatchString(matches[2]) {
+			return hazard{
+				rule:       RuleVolatileDefault,
+				table:      table,
+				message:    fmt.Sprintf("adding column %s with a volatile default rewrites %s while holding an ACCESS EXCLUSIVE lock", matches[1], table),
+				suggestion: "add the column without a default, set the default in a separate statement, then backfill existing rows in batches",
+			}, true
+		}
+		return hazard{}, false
+	}
+	if addCheckPattern.MatchString(action) && !notValidPattern.MatchString(action) {
+		return hazard{
+			rule:       RuleNotNull,
+			table:      table,
+			message:    fmt.Sprintf("adding a CHECK constraint without NOT VALID scans %s while holding an ACCESS EXCLUSIVE lock", table),
+			suggestion: "add the constraint NOT VALID, then VALIDATE CONSTRAINT in a separate statement, which does not block writes",
+		}, true
+	}
+	if matches := columnTypePattern.FindStringSubmatch(action); matches != nil {
+		return hazard{
+			rule:       RuleColumnType,
+			table:      table,
+			message:    fmt.Sprintf("changing the type of %s rewrites %s and its indexes while holding an ACCESS EXCLUSIVE lock, unless the types are binary compatible", matches[1], table),
+			suggestion: "add a column with the new type, backfill it in batches, move the application over, then drop the old column",
+		}, true
+	}
+	if matches := setNotNullPattern.FindStringSubmatch(action); matches != nil {
+		return hazard{
+			rule:    RuleNotNull,
+			table:   table,
+			message: fmt.Sprintf("SET NOT NULL on %s scans %s while holding an ACCESS EXCLUSIVE lock", matches[1], table),
+			suggestion: fmt.Sprintf("add CHECK (%s IS NOT NULL) NOT VALID, VALIDATE CONSTRAINT in a separate statement, "+
+				"then SET NOT NULL, which uses the validated constraint instead of scanning", matches[1]),
+		}, true
+	}
+	if matches := dropColumnPattern.FindStringSubmatch(action); matches != nil && !strings.EqualFold(matches[1], "CONSTRAINT") {
+		return hazard{
+			rule:       RuleDropColumn,
+			table:      table,
+			message:    fmt.Sprintf("dropping column %s breaks any running code that still uses it", matches[1]),
+			suggestion: "stop using the column in the application and deploy that first, then drop it in a later migration",
+		}, true
+	}
+	if matches := renamePattern.FindStringSubmatch(action); matches != nil && matches[1] == "" {
+		return hazard{
+			rule:       RuleRename,
+			table:      table,
+			message:    fmt.Sprintf("%s breaks any running code that still uses the old name", action),
+			suggestion: "add the new name alongside the old one, for example with a new column kept in sync or a view, move the application over, then remove the old name",
+		}, true
+	}
+	return hazard{}, false
+}
+
+// tableKey returns the unquoted, lower case name of a possibly schema qualified table, without the schema.
+func tableKey(table string) string {
+	if i := strings.LastIndexByte(table, '.'); i >= 0 {
+		table = table[i+1:]
+	}
+	return strings.ToLower(strings.Trim(table, `"`))
+}
+
+// splitTopLevel splits s at commas that are not inside parentheses, trimming each part.
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, strings.TrimSpace(s[start:]))
+}
+
+// parseIgnoreDirective returns the rules named by an ignore directive in the text of a line comment.
+func parseIgnoreDirective(comment string) ([]LintRule, bool) {
+	directive, ok := strings.CutPrefix(strings.TrimSpace(comment), ignoreDirective)
+	if !ok || (directive != "" && !strings.ContainsAny(directive[:1], " \t,")) {
+		return nil, false
+	}
+	names := strings.FieldsFunc(directive, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == ','
+	})
+	if len(names) == 0 {
+		return []LintRule{""}, true
+	}
+	rules := make([]LintRule, 0, len(names))
+	for _, name := range names {
+		rules = append(rules, LintRule(name))
+	}
+	return rules, true
+}
@@ -0,0 +1,126 @@
+package dbmigrate_test
+
+import (
+	"bytes"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/pennsieve/dbmigrate-go/pkg/dbmigrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// lintSQL lints a single up migration with body and returns its findings one per line
+func lintSQL(t *testing.T, body string) string {
+	t.Helper()
+	migrationsSource, err := iofs.New(fstest.MapFS{
+		"20250101000000_change.up.sql":   sqlFile(body),
+		"20250101000000_change.down.sql": sqlFile("SELECT 1;"),
+	}, ".")
+	require.NoError(t, err)
+	report, err := dbmigrate.Lint(migrationsSource)
+	require.NoError(t, err)
+	return findingsText(report)
+}
+
+func TestLint_SQL(t *testing.T) {
+	tests := []struct {
+		scenario string
+		body     string
+		expected dbmigrate.LintRule
+	}{
+		{"volatile default", "ALTER TABLE users ADD COLUMN token UUID DEFAULT gen_random_uuid();", dbmigrate.RuleVolatileDefault},
+		{"serial column", "ALTER TABLE users ADD COLUMN seq BIGSERIAL;", dbmigrate.RuleVolatileDefault},
+		{"index", "CREATE UNIQUE INDEX users_email ON users (email);", dbmigrate.RuleIndexNotConcurrent},
+		{"unnamed index", "create index on public.users(email);", dbmigrate.RuleIndexNotConcurrent},
+		{"column type", "ALTER TABLE users ALTER COLUMN name TYPE TEXT;", dbmigrate.RuleColumnType},
+		{"set data type", "ALTER TABLE users ALTER name SET DATA TYPE TEXT USING name::text;", dbmigrate.RuleColumnType},
+		{"drop column", "ALTER TABLE users DROP COLUMN IF EXISTS name;", dbmigrate.RuleDropColumn},
+		{"set not null", "ALTER TABLE users ALTER COLUMN name SET NOT NULL;", dbmigrate.RuleNotNull},
+		{"not null check", "ALTER TABLE users ADD CONSTRAINT name_not_null CHECK (name IS NOT NULL);", dbmigrate.RuleNotNull},
+		{"rename column", "ALTER TABLE users RENAME COLUMN name TO full_name;", dbmigrate.RuleRename},
+		{"rename table", "ALTER TABLE users RENAME TO people;", dbmigrate.RuleRename},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			findings := lintSQL(t, tt.body)
+			assert.True(t, strings.HasSuffix(findings, "("+string(tt.expected)+")"), findings)
+			assert.NotContains(t, findings, "\n")
+		})
+	}
+}
+
+func TestLint_SafeSQL(t *testing.T) {
+	tests := []struct {
+		scenario string
+		body     string
+	}{
+		{"stable default", "ALTER TABLE users ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT now();"},
+		{"concurrent index", "CREATE INDEX CONCURRENTLY users_email ON users (email);"},
+		{"not valid check", "ALTER TABLE users ADD CONSTRAINT name_not_null CHECK (name IS NOT NULL) NOT VALID;"},
+		{"validate", "ALTER TABLE users VALIDATE CONSTRAINT name_not_null;"},
+		{"drop constraint", "ALTER TABLE users DROP CONSTRAINT name_not_null, ALTER COLUMN name DROP NOT NULL;"},
+		{"rename constraint", "ALTER TABLE users RENAME CONSTRAINT a TO b;"},
+		{"new table", `CREATE TABLE "Users" (id INT);
+CREATE INDEX users_id ON public."Users" (id);
+ALTER TABLE "Users" ADD COLUMN seq SERIAL, ALTER COLUMN id SET NOT NULL;`},
+		{"comments and literals", `-- ALTER TABLE users DROP COLUMN name;
+/* CREATE INDEX a ON b (c); /* nested */ DROP TABLE users; */
+COMMENT ON TABLE users IS 'ALTER TABLE users DROP COLUMN name;';
+DO $body$ BEGIN EXECUTE 'ALTER TABLE users RENAME TO people'; END $body$;`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			assert.Empty(t, lintSQL(t, tt.body))
+		})
+	}
+}
+
+func TestLint_SQLLocation(t *testing.T) {
+	findings := lintSQL(t, `CREATE TABLE t (id INT);
+
+ALTER TABLE users
+    ADD COLUMN token UUID DEFAULT gen_random_uuid(),
+    DROP COLUMN name;
+CREATE INDEX users_email ON users (email);`)
+
+	assert.Equal(t, strings.Join([]string{
+		"warning 20250101000000_change.up.sql:3: adding column token with a volatile default rewrites users while holding an ACCESS EXCLUSIVE lock (volatile-default)",
+		"warning 20250101000000_change.up.sql:6: CREATE INDEX without CONCURRENTLY blocks writes to users until the index is built (index-not-concurrent)",
+		"warning 20250101000000_change.up.sql:3: dropping column name breaks any running code that still uses it (drop-column)",
+	}, "\n"), findings)
+}
+
+func TestLint_SQLIgnoreDirective(t *testing.T) {
+	findings := lintSQL(t, `-- dbmigrate:ignore index-not-concurrent
+CREATE INDEX users_email ON users (email);
+ALTER TABLE users
+    -- dbmigrate:ignore drop-column, rename
+    DROP COLUMN name;
+ALTER TABLE users ALTER COLUMN id SET NOT NULL; -- dbmigrate:ignore
+ALTER TABLE users RENAME COLUMN email TO address; -- dbmigrate:ignore drop-column
+-- dbmigrate:ignored is not a directive
+ALTER TABLE users DROP COLUMN age;`)
+
+	assert.Equal(t, strings.Join([]string{
+		"warning 20250101000000_change.up.sql:9: dropping column age breaks any running code that still uses it (drop-column)",
+		"warning 20250101000000_change.up.sql:7: RENAME COLUMN email TO address breaks any running code that still uses the old name (rename)",
+	}, "\n"), findings)
+}
+
+func TestLintReport_WriteText(t *testing.T) {
+	migrationsSource, err := iofs.New(fstest.MapFS{
+		"20250101000000_drop.up.sql":   sqlFile("ALTER TABLE users DROP COLUMN name;"),
+		"20250101000000_drop.down.sql": sqlFile("ALTER TABLE users ADD COLUMN name TEXT;"),
+	}, ".")
+	require.NoError(t, err)
+	report, err := dbmigrate.Lint(migrationsSource, dbmigrate.WithSeverity(dbmigrate.RuleDropColumn, dbmigrate.SeverityError))
+	require.NoError(t, err)
+	assert.True(t, report.HasErrors())
+
+	var out bytes.Buffer
+	require.NoError(t, report.WriteText(&out))
+	assert.Equal(t, "error 20250101000000_drop.up.sql:1: dropping column name breaks any running code that still uses it (drop-column)\n"+
+		"    suggestion: stop using the column in the application and deploy that first, then drop it in a later migration\n", out.String())
+}
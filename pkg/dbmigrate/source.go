@@ -0,0 +1,101 @@
+package dbmigrate
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4/source"
+	"io"
+	"os"
+)
+
+// Migration identifies a single migration available from the source.Driver.
+type Migration struct {
+	Version    uint   `json:"version"`
+	Identifier string `json:"identifier"`
+}
+
+// Direction is the direction in which a migration is applied.
+type Direction string
+
+const (
+	DirectionUp   Direction = "up"
+	DirectionDown Direction = "down"
+)
+
+// sourceMigrations walks the source.Driver from its first version and returns
+// every migration it serves in ascending version order.
+func sourceMigrations(migrationsSource source.Driver) ([]Migration, error) {
+	var migrations []Migration
+	version, err := migrationsSource.First()
+	for err == nil {
+		identifier, idErr := sourceIdentifier(migrationsSource, version)
+		if idErr != nil {
+			return nil, idErr
+		}
+		migrations = append(migrations, Migration{Version: version, Identifier: identifier})
+		version, err = migrationsSource.Next(version)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error reading migration versions from source: %w", err)
+	}
+	return migrations, nil
+}
+
+// sourceIdentifier returns the identifier of the up migration for version, falling
+// back to that of the down migration if the version has no up migration.
+func sourceIdentifier(migrationsSource source.Driver, version uint) (string, error) {
+	r, identifier, err := migrationsSource.ReadUp(version)
+	if errors.Is(err, os.ErrNotExist) {
+		r, identifier, err = migrationsSource.ReadDown(version)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading migration %d from source: %w", version, err)
+	}
+	return identifier, closeReader(r, version)
+}
+
+// directionIdentifier returns the identifier of the migration for version in the given direction,
+// or "" if the source has no such migration.
+func directionIdentifier(migrationsSource source.Driver, version uint, direction Direction) (string, error) {
+	var r io.ReadCloser
+	var identifier string
+	var err error
+	if direction == DirectionUp {
+		r, identifier, err = migrationsSource.ReadUp(version)
+	} else {
+		r, identifier, err = migrationsSource.ReadDown(version)
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading %s migration %d from source: %w", direction, version, err)
+	}
+	return identifier, closeReader(r, version)
+}
+
+// readMigration returns the body and identifier of the migration for version in the given direction.
+// If the source has no migration for version in that direction the returned error wraps os.ErrNotExist.
+func readMigration(migrationsSource source.Driver, version uint, direction Direction) (body []byte, identifier string, err error) {
+	var r io.ReadCloser
+	if direction == DirectionUp {
+		r, identifier, err = migrationsSource.ReadUp(version)
+	} else {
+		r, identifier, err = migrationsSource.ReadDown(version)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading %s migration %d from source: %w", direction, version, err)
+	}
+	body, err = io.ReadAll(r)
+	if err != nil {
+		return nil, "", closeOnError(fmt.Errorf("error reading %s migration %d body: %w", direction, version, err), r)
+	}
+	return body, identifier, closeReader(r, version)
+}
+
+func closeReader(r io.Closer, version uint) error {
+	if err := r.Close(); err != nil {
+		return fmt.Errorf("error closing migration %d reader: %w", version, err)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package dbmigrate
+
+import (
+	"regexp"
+	"strings"
+)
+
+var dollarQuotePattern = regexp.MustCompile(`^\$(?:[A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// sqlStatement is a single statement of a migration file.
+type sqlStatement struct {
+	// query is the statement as written, without the terminating semicolon or comments before it
+	query string
+	// text has comments removed, string and dollar quoted literals emptied and whitespace collapsed, for matching
+	text string
+	// line is the line of the file the statement starts on
+	line int
+	// ignored are the rules suppressed by directives, with an empty rule for all rules
+	ignored map[LintRule]bool
+}
+
+func (s *sqlStatement) ignores(rule LintRule) bool {
+	return s.ignored[rule] || s.ignored[""]
+}
+
+// splitStatements splits a migration file into statements at semicolons outside comments, quotes and
+// dollar quotes, and attaches each ignore directive to its statement.
+func splitStatements(body string) []*sqlStatement {
+	var (
+		statements []*sqlStatement
+		current    strings.Builder
+		started    bool
+		// start and startLine are the offset and line of the first token of the current statement
+		start     int
+		startLine int
+		line      = 1
+		pending   = map[LintRule]bool{}
+		previous  *sqlStatement
+		// previousEnd is the line the previous statement ended on
+		previousEnd int
+	)
+	// write adds s, found at offset i of body, to the text of the current statement
+	write := func(s string, i int) {
+		if !started && strings.TrimSpace(s) != "" {
+			started, start, startLine = true, i, line
+		}
+		current.WriteString(s)
+	}
+	// flush ends the current statement at offset i of body
+	flush := func(i int) {
+		text := strings.Join(strings.Fields(current.String()), " ")
+		current.Reset()
+		if !started || text == "" {
+			started = false
+			return
+		}
+		started = false
+		previous = &sqlStatement{query: strings.TrimSpace(body[start:i]), text: text, line: startLine, ignored: pending}
+		previousEnd = line
+		statements = append(statements, previous)
+		pending = map[LintRule]bool{}
+	}
+	// skip moves past s, counting its lines
+	skip := func(s string) int {
+		line += strings.Count(s, "\n")
+		return len(s)
+	}
+	for i := 0; i < len(body); {
+		rest := body[i:]
+		switch {
+		case strings.HasPrefix(rest, "--"):
+			comment, _, _ := strings.Cut(rest, "\n")
+			if rules, ok := parseIgnoreDirective(comment[2:]); ok {
+				target := pending
+				if !started && previous != nil && previousEnd == line {
+					target = previous.ignored
+				}
+				for _, rule := range rules {
+					target[rule] = true
+				}
+			}
+			write(" ", i)
+			i += len(comment)
+		case strings.HasPrefix(rest, "/*"):
+			// block comments nest
+			end, depth := 2, 1
+			for end < len(rest) && depth > 0 {
+				switch {
+				case strings.HasPrefix(rest[end:], "/*"):
+					depth, end = depth+1, end+2
+				case strings.HasPrefix(rest[end:], "*/"):
+					depth, end = depth-1, end+2
+				default:
+					end++
+				}
+			}
+			write(" ", i)
+			i += skip(rest[:end])
+		case rest[0] == '\'':
+			escapes := i > 0 && (body[i-1] == 'E' || body[i-1] == 'e')
+			end := 1
+			for end < len(rest) && rest[end] != '\'' {
+				if escapes && rest[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			write("''", i)
+			i += skip(rest[:min(end+1, len(rest))])
+		case rest[0] == '"':
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				end = len(rest) - 2
+			}
+			quoted := rest[:end+2]
+			write(quoted, i)
+			i += skip(quoted)
+		case rest[0] == '$' && dollarQuotePattern.MatchString(rest):
+			tag := dollarQuotePattern.FindString(rest)
+			end := strings.Index(rest[len(tag):], tag)
+			if end < 0 {
+				end = len(rest) - 2*len(tag)
+			}
+			write("$$", i)
+			i += skip(rest[:min(end+2*len(tag), len(rest))])
+		case rest[0] == ';':
+			flush(i)
+			i++
+		default:
+			if rest[0] == '\n' {
+				line++
+			}
+			write(rest[:1], i)
+			i++
+		}
+	}
+	flush(len(body))
+	return statements
+}
@@ -0,0 +1,52 @@
+package dbmigrate
+
+import (
+	"context"
+	"github.com/golang-migrate/migrate/v4/database"
+)
+
+// Status describes the migration state of the schema.
+type Status struct {
+	// Version is the currently applied migration version. Only meaningful if HasVersion is true.
+	Version uint `json:"version"`
+	// HasVersion is false if no migration has been applied yet.
+	HasVersion bool `json:"hasVersion"`
+	// Dirty is true if the last migration run failed part way through. Migrations cannot be
+	// run again until the dirty state has been resolved.
+	Dirty bool `json:"dirty"`
+	// Applied are the migrations from the source at or below Version, in ascending order.
+	Applied []Migration `json:"applied"`
+	// Pending are the migrations from the source above Version, in ascending order.
+	Pending []Migration `json:"pending"`
+}
+
+// Status reports the currently applied version, whether it is dirty, and which of the
+// migrations served by the source.Driver have been applied and which are still pending.
+func (m *DatabaseMigrator) Status(ctx context.Context) (*Status, error) {
+	status := &Status{Applied: []Migration{}, Pending: []Migration{}}
+	version, dirty, err := m.database.versionContext(ctx)
+	if err != nil {
+		// a database.Error does not wrap the context's error
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	if version != database.NilVersion {
+		status.Version = uint(version)
+		status.HasVersion = true
+		status.Dirty = dirty
+	}
+	migrations, err := sourceMigrations(m.source)
+	if err != nil {
+		return nil, err
+	}
+	for _, migration := range migrations {
+		if status.HasVersion && migration.Version <= status.Version {
+			status.Applied = append(status.Applied, migration)
+		} else {
+			status.Pending = append(status.Pending, migration)
+		}
+	}
+	return status, nil
+}
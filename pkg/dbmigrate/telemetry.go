@@ -0,0 +1,139 @@
+package dbmigrate
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+	"time"
+)
+
+// instrumentationName is the name of the Tracer and Meter used by DatabaseMigrator.
+const instrumentationName = "github.com/pennsieve/dbmigrate-go/pkg/dbmigrate"
+
+// Attribute keys used on DatabaseMigrator spans and metrics.
+const (
+	DBSystemKey    = attribute.Key("db.system")
+	DBNamespaceKey = attribute.Key("db.namespace")
+	SchemaKey      = attribute.Key("dbmigrate.schema")
+	OperationKey   = attribute.Key("dbmigrate.operation")
+	VersionKey     = attribute.Key("dbmigrate.version")
+	DirectionKey   = attribute.Key("dbmigrate.direction")
+	IdentifierKey  = attribute.Key("dbmigrate.identifier")
+)
+
+const (
+	dbSystemPostgres = "postgresql"
+	// runSpanPrefix is followed by the operation, for example "dbmigrate.up"
+	runSpanPrefix     = "dbmigrate."
+	migrationSpanName = "dbmigrate.migration"
+)
+
+// telemetry creates the spans and records the metrics for a DatabaseMigrator. With no providers
+// configured it uses no-op implementations.
+type telemetry struct {
+	tracer trace.Tracer
+	// attributes are the schema and database, which are common to every span and measurement
+	attributes []attribute.KeyValue
+
+	migrationDuration metric.Float64Histogram
+	lockWait          metric.Float64Histogram
+	migrationFailures metric.Int64Counter
+	runFailures       metric.Int64Counter
+}
+
+func newTelemetry(tracerProvider trace.TracerProvider, meterProvider metric.MeterProvider, schemaName, databaseName string) (*telemetry, error) {
+	if tracerProvider == nil {
+		tracerProvider = tracenoop.NewTracerProvider()
+	}
+	if meterProvider == nil {
+		meterProvider = metricnoop.NewMeterProvider()
+	}
+	meter := meterProvider.Meter(instrumentationName)
+	t := &telemetry{
+		tracer: tracerProvider.Tracer(instrumentationName),
+		attributes: []attribute.KeyValue{
+			DBSystemKey.String(dbSystemPostgres),
+			DBNamespaceKey.String(databaseName),
+			SchemaKey.String(schemaName),
+		},
+	}
+	var err error
+	if t.migrationDuration, err = meter.Float64Histogram("dbmigrate.migration.duration",
+		metric.WithDescription("Duration of each migration, successful or not"),
+		metric.WithUnit("s")); err != nil {
+		return nil, fmt.Errorf("error creating migration duration histogram: %w", err)
+	}
+	if t.lockWait, err = meter.Float64Histogram("dbmigrate.lock.wait",
+		metric.WithDescription("Time spent waiting for the migration advisory lock"),
+		metric.WithUnit("s")); err != nil {
+		return nil, fmt.Errorf("error creating lock wait histogram: %w", err)
+	}
+	if t.migrationFailures, err = meter.Int64Counter("dbmigrate.migration.failures",
+		metric.WithDescription("Number of migrations that failed"),
+		metric.WithUnit("{migration}")); err != nil {
+		return nil, fmt.Errorf("error creating migration failures counter: %w", err)
+	}
+	if t.runFailures, err = meter.Int64Counter("dbmigrate.run.failures",
+		metric.WithDescription("Number of runs of Up, Migrate, Steps or Down that failed"),
+		metric.WithUnit("{run}")); err != nil {
+		return nil, fmt.Errorf("error creating run failures counter: %w", err)
+	}
+	return t, nil
+}
+
+// with returns the common attributes followed by extra.
+func (t *telemetry) with(extra ...attribute.KeyValue) []attribute.KeyValue {
+	return append(append(make([]attribute.KeyValue, 0, len(t.attributes)+len(extra)), t.attributes...), extra...)
+}
+
+// startRun starts the parent span of a run. The returned function ends it, recording err if it is not nil.
+func (t *telemetry) startRun(ctx context.Context, operation string) (context.Context, func(err error)) {
+	ctx, span := t.tracer.Start(ctx, runSpanPrefix+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(t.with(OperationKey.String(operation))...))
+	return ctx, func(err error) {
+		if err != nil {
+			t.runFailures.Add(ctx, 1, metric.WithAttributes(t.with(OperationKey.String(operation))...))
+			failSpan(span, err)
+		}
+		span.End()
+	}
+}
+
+// startMigration starts the span of a single migration, as a child of the run span in ctx.
+func (t *telemetry) startMigration(ctx context.Context, event MigrationEvent) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, migrationSpanName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(t.with(
+			VersionKey.Int64(int64(event.Version)),
+			DirectionKey.String(string(event.Direction)),
+			IdentifierKey.String(event.Identifier))...))
+}
+
+// endMigration ends the span started by startMigration and records the migration's duration,
+// and its failure if event.Err is set.
+func (t *telemetry) endMigration(ctx context.Context, span trace.Span, event MigrationEvent) {
+	t.migrationDuration.Record(ctx, event.Elapsed.Seconds(),
+		metric.WithAttributes(t.with(DirectionKey.String(string(event.Direction)))...))
+	if event.Err != nil {
+		t.migrationFailures.Add(ctx, 1, metric.WithAttributes(t.with(
+			VersionKey.Int64(int64(event.Version)),
+			DirectionKey.String(string(event.Direction)))...))
+		failSpan(span, event.Err)
+	}
+	span.End()
+}
+
+func (t *telemetry) recordLockWait(ctx context.Context, wait time.Duration) {
+	t.lockWait.Record(ctx, wait.Seconds(), metric.WithAttributes(t.attributes...))
+}
+
+func failSpan(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
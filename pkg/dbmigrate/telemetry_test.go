@@ -0,0 +1,108 @@
+package dbmigrate
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+	"time"
+)
+
+func TestTelemetry(t *testing.T) {
+	ctx := context.Background()
+	spanExporter := tracetest.NewInMemoryExporter()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(spanExporter))
+	metricReader := sdkmetric.NewManualReader()
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(metricReader))
+
+	tel, err := newTelemetry(tracerProvider, meterProvider, "test_schema", "test_db")
+	require.NoError(t, err)
+
+	runCtx, endRun := tel.startRun(ctx, "up")
+	tel.recordLockWait(runCtx, 20*time.Millisecond)
+
+	succeeded := MigrationEvent{Version: 20250319124829, Direction: DirectionUp, Identifier: "create_updated_at_trigger"}
+	migrationCtx, span := tel.startMigration(runCtx, succeeded)
+	succeeded.Elapsed = 50 * time.Millisecond
+	tel.endMigration(migrationCtx, span, succeeded)
+
+	migrationErr := errors.New("migration failed")
+	failed := MigrationEvent{Version: 20250509172500, Direction: DirectionUp, Identifier: "create_table"}
+	migrationCtx, span = tel.startMigration(runCtx, failed)
+	failed.Elapsed = 10 * time.Millisecond
+	failed.Err = migrationErr
+	tel.endMigration(migrationCtx, span, failed)
+
+	endRun(migrationErr)
+
+	spans := spanExporter.GetSpans()
+	require.Len(t, spans, 3)
+	first, second, run := spans[0], spans[1], spans[2]
+
+	assert.Equal(t, "dbmigrate.up", run.Name)
+	assert.False(t, run.Parent.IsValid())
+	assert.Equal(t, codes.Error, run.Status.Code)
+	assert.Contains(t, run.Attributes, OperationKey.String("up"))
+
+	for _, migrationSpan := range []tracetest.SpanStub{first, second} {
+		assert.Equal(t, "dbmigrate.migration", migrationSpan.Name)
+		assert.Equal(t, run.SpanContext.SpanID(), migrationSpan.Parent.SpanID())
+		assert.Contains(t, migrationSpan.Attributes, SchemaKey.String("test_schema"))
+		assert.Contains(t, migrationSpan.Attributes, DBNamespaceKey.String("test_db"))
+		assert.Contains(t, migrationSpan.Attributes, DirectionKey.String("up"))
+	}
+	assert.Contains(t, first.Attributes, VersionKey.Int64(20250319124829))
+	assert.Contains(t, first.Attributes, IdentifierKey.String("create_updated_at_trigger"))
+	assert.Equal(t, codes.Unset, first.Status.Code)
+	assert.Contains(t, second.Attributes, VersionKey.Int64(20250509172500))
+	assert.Equal(t, codes.Error, second.Status.Code)
+	assert.Equal(t, "migration failed", second.Status.Description)
+	require.Len(t, second.Events, 1)
+	assert.Equal(t, "exception", second.Events[0].Name)
+
+	var metrics metricdata.ResourceMetrics
+	require.NoError(t, metricReader.Collect(ctx, &metrics))
+	require.Len(t, metrics.ScopeMetrics, 1)
+	byName := map[string]metricdata.Aggregation{}
+	for _, m := range metrics.ScopeMetrics[0].Metrics {
+		byName[m.Name] = m.Data
+	}
+
+	duration := byName["dbmigrate.migration.duration"].(metricdata.Histogram[float64])
+	require.Len(t, duration.DataPoints, 1)
+	assert.Equal(t, uint64(2), duration.DataPoints[0].Count)
+	assert.InDelta(t, 0.06, duration.DataPoints[0].Sum, 1e-9)
+
+	lockWait := byName["dbmigrate.lock.wait"].(metricdata.Histogram[float64])
+	require.Len(t, lockWait.DataPoints, 1)
+	assert.Equal(t, uint64(1), lockWait.DataPoints[0].Count)
+
+	migrationFailures := byName["dbmigrate.migration.failures"].(metricdata.Sum[int64])
+	require.Len(t, migrationFailures.DataPoints, 1)
+	assert.Equal(t, int64(1), migrationFailures.DataPoints[0].Value)
+	version, ok := migrationFailures.DataPoints[0].Attributes.Value(VersionKey)
+	require.True(t, ok)
+	assert.Equal(t, attribute.Int64Value(20250509172500), version)
+
+	runFailures := byName["dbmigrate.run.failures"].(metricdata.Sum[int64])
+	require.Len(t, runFailures.DataPoints, 1)
+	assert.Equal(t, int64(1), runFailures.DataPoints[0].Value)
+}
+
+func TestTelemetry_NoProviders(t *testing.T) {
+	tel, err := newTelemetry(nil, nil, "test_schema", "test_db")
+	require.NoError(t, err)
+
+	ctx, endRun := tel.startRun(context.Background(), "down")
+	migrationCtx, span := tel.startMigration(ctx, MigrationEvent{Version: 1, Direction: DirectionDown})
+	assert.False(t, span.SpanContext().IsValid())
+	tel.endMigration(migrationCtx, span, MigrationEvent{Version: 1, Direction: DirectionDown, Err: errors.New("failed")})
+	endRun(nil)
+}
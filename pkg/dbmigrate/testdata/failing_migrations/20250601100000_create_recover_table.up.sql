@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS recover_table
+(
+    id   SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL
+);
@@ -0,0 +1,3 @@
+ALTER TABLE recover_table DROP COLUMN IF EXISTS node_id;
+
+ALTER TABLE recover_table DROP COLUMN IF EXISTS description;
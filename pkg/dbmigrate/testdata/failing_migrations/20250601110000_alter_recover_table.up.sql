@@ -0,0 +1,3 @@
+ALTER TABLE recover_table ADD COLUMN description VARCHAR(255);
+
+ALTER TABLE recover_table ADD COLUMN node_id VARCHAR(255) REFERENCES missing_table (node_id);
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS slow_table
+(
+    id SERIAL PRIMARY KEY
+);
@@ -0,0 +1 @@
+ALTER TABLE slow_table DROP COLUMN IF EXISTS name;
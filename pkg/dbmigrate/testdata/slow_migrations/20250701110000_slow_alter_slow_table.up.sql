@@ -0,0 +1,3 @@
+SELECT pg_sleep(3);
+
+ALTER TABLE slow_table ADD COLUMN name VARCHAR(255);
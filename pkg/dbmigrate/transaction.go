@@ -0,0 +1,98 @@
+package dbmigrate
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Directives in the header of a migration file, the comment lines before its first statement, choose
+// how the file is run. Without either, the file is sent to Postgres as a single multi-statement exec,
+// as golang-migrate's pgx driver does.
+const (
+	// transactionDirective runs the file in a transaction. If it fails the transaction is rolled back and
+	// the schema is left clean at its previous version instead of dirty. The file must not contain
+	// its own BEGIN or COMMIT.
+	transactionDirective = "dbmigrate:transaction"
+	// noTransactionDirective runs the statements of the file one at a time outside a transaction, for
+	// statements such as CREATE INDEX CONCURRENTLY that cannot run in one. If a statement fails the
+	// schema is left dirty.
+	noTransactionDirective = "dbmigrate:no-transaction"
+)
+
+// transactionMode is how a migration file is run.
+type transactionMode int
+
+const (
+	transactionDefault transactionMode = iota
+	transactionWrap
+	transactionNone
+)
+
+// headerTransactionMode returns the transactionMode chosen by the directives in the header of body.
+func headerTransactionMode(body string) (transactionMode, error) {
+	mode := transactionDefault
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	scanner.Buffer(nil, len(body)+1)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		comment, isComment := strings.CutPrefix(line, "--")
+		if !isComment {
+			break
+		}
+		var directiveMode transactionMode
+		switch strings.TrimSpace(comment) {
+		case transactionDirective:
+			directiveMode = transactionWrap
+		case noTransactionDirective:
+			directiveMode = transactionNone
+		default:
+			continue
+		}
+		if mode != transactionDefault && mode != directiveMode {
+			return transactionDefault, fmt.Errorf("migration has both %s and %s directives", transactionDirective, noTransactionDirective)
+		}
+		mode = directiveMode
+	}
+	return mode, nil
+}
+
+// execInTransaction runs query on conn in a transaction, rolling it back if query fails.
+func execInTransaction(ctx context.Context, conn *sql.Conn, query string) error {
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("error starting migration transaction: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return rollbackOnError(tx, migrationError(query, err))
+	}
+	if err := tx.Commit(); err != nil {
+		return migrationError(query, err)
+	}
+	return nil
+}
+
+// execStatements runs the statements of query on conn one at a time.
+func execStatements(ctx context.Context, conn *sql.Conn, query string) error {
+	for _, statement := range splitStatements(query) {
+		if _, err := conn.ExecContext(ctx, statement.query); err != nil {
+			return statementError(query, statement, err)
+		}
+	}
+	return nil
+}
+
+// statementError is migrationError for a single statement of query, with the line in query.
+func statementError(query string, statement *sqlStatement, err error) error {
+	statementErr := migrationError(statement.query, err)
+	if statementErr.Line > 0 {
+		statementErr.Line += uint(statement.line - 1)
+	}
+	statementErr.Query = []byte(query)
+	return statementErr
+}
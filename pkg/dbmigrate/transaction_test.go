@@ -0,0 +1,61 @@
+package dbmigrate
+
+import (
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestHeaderTransactionMode(t *testing.T) {
+	tests := []struct {
+		scenario string
+		body     string
+		expected transactionMode
+	}{
+		{"none", "CREATE TABLE t (id INT);", transactionDefault},
+		{"transaction", "-- dbmigrate:transaction\nCREATE TABLE t (id INT);", transactionWrap},
+		{"no transaction", "\n-- add an index\n  --   dbmigrate:no-transaction\n\nCREATE INDEX CONCURRENTLY i ON t (id);", transactionNone},
+		{"after first statement", "CREATE TABLE t (id INT);\n-- dbmigrate:no-transaction\n", transactionDefault},
+		{"repeated", "-- dbmigrate:transaction\n-- dbmigrate:transaction\nSELECT 1;", transactionWrap},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			mode, err := headerTransactionMode(tt.body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, mode)
+		})
+	}
+
+	_, err := headerTransactionMode("-- dbmigrate:transaction\n-- dbmigrate:no-transaction\nSELECT 1;")
+	assert.Error(t, err)
+}
+
+func TestSplitStatements(t *testing.T) {
+	statements := splitStatements(`-- dbmigrate:no-transaction
+CREATE INDEX CONCURRENTLY a ON t (id);
+
+/* the second; index */
+CREATE INDEX CONCURRENTLY b
+    ON t (name) WHERE name <> ';';
+DO $$ BEGIN PERFORM 1; END $$;
+-- trailing comment`)
+
+	require.Len(t, statements, 3)
+	assert.Equal(t, "CREATE INDEX CONCURRENTLY a ON t (id)", statements[0].query)
+	assert.Equal(t, 2, statements[0].line)
+	assert.Equal(t, "CREATE INDEX CONCURRENTLY b\n    ON t (name) WHERE name <> ';'", statements[1].query)
+	assert.Equal(t, "CREATE INDEX CONCURRENTLY b ON t (name) WHERE name <> ''", statements[1].text)
+	assert.Equal(t, 5, statements[1].line)
+	assert.Equal(t, "DO $$ BEGIN PERFORM 1; END $$", statements[2].query)
+	assert.Equal(t, 7, statements[2].line)
+}
+
+func TestStatementError(t *testing.T) {
+	query := "SELECT 1;\n\nSELECT\n  nope;"
+	statements := splitStatements(query)
+	require.Len(t, statements, 2)
+
+	err := statementError(query, statements[1], &pgconn.PgError{Message: `column "nope" does not exist`, Position: 10})
+	assert.ErrorContains(t, err, "in line 4")
+}
@@ -0,0 +1,103 @@
+package dbmigratetest
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// Querier is what the assertions query the catalog with, such as a *pgx.Conn or *pgxpool.Pool.
+type Querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+const (
+	tableExistsQuery = `SELECT EXISTS (SELECT 1 FROM pg_tables WHERE schemaname = $1 AND tablename = $2)`
+
+	columnExistsQuery = `SELECT EXISTS (SELECT 1 FROM information_schema.columns
+		WHERE table_schema = $1 AND table_name = $2 AND column_name = $3)`
+
+	functionExistsQuery = `SELECT EXISTS (SELECT 1 FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE n.nspname = $1 AND p.proname = $2)`
+
+	triggerExistsQuery = `SELECT EXISTS (SELECT 1 FROM pg_trigger tg
+		JOIN pg_class c ON c.oid = tg.tgrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relname = $2 AND tg.tgname = $3 AND NOT tg.tgisinternal)`
+
+	indexExistsQuery = `SELECT EXISTS (SELECT 1 FROM pg_indexes WHERE schemaname = $1 AND tablename = $2 AND indexname = $3)`
+)
+
+// AssertTableExists asserts that schema has the table.
+func AssertTableExists(t assert.TestingT, db Querier, schema, table string) bool {
+	Helper(t)
+	return assertExists(t, db, true, fmt.Sprintf("table %s.%s", schema, table), tableExistsQuery, schema, table)
+}
+
+// AssertTableNotExists asserts that schema does not have the table.
+func AssertTableNotExists(t assert.TestingT, db Querier, schema, table string) bool {
+	Helper(t)
+	return assertExists(t, db, false, fmt.Sprintf("table %s.%s", schema, table), tableExistsQuery, schema, table)
+}
+
+// AssertColumnExists asserts that the table of schema has the column.
+func AssertColumnExists(t assert.TestingT, db Querier, schema, table, column string) bool {
+	Helper(t)
+	return assertExists(t, db, true, fmt.Sprintf("column %s.%s.%s", schema, table, column), columnExistsQuery, schema, table, column)
+}
+
+// AssertColumnNotExists asserts that the table of schema does not have the column.
+func AssertColumnNotExists(t assert.TestingT, db Querier, schema, table, column string) bool {
+	Helper(t)
+	return assertExists(t, db, false, fmt.Sprintf("column %s.%s.%s", schema, table, column), columnExistsQuery, schema, table, column)
+}
+
+// AssertFunctionExists asserts that schema has a function or procedure with the name, whatever its arguments.
+func AssertFunctionExists(t assert.TestingT, db Querier, schema, function string) bool {
+	Helper(t)
+	return assertExists(t, db, true, fmt.Sprintf("function %s.%s", schema, function), functionExistsQuery, schema, function)
+}
+
+// AssertFunctionNotExists asserts that schema has no function or procedure with the name.
+func AssertFunctionNotExists(t assert.TestingT, db Querier, schema, function string) bool {
+	Helper(t)
+	return assertExists(t, db, false, fmt.Sprintf("function %s.%s", schema, function), functionExistsQuery, schema, function)
+}
+
+// AssertTriggerExists asserts that the table of schema has the trigger.
+func AssertTriggerExists(t assert.TestingT, db Querier, schema, table, trigger string) bool {
+	Helper(t)
+	return assertExists(t, db, true, fmt.Sprintf("trigger %s on %s.%s", trigger, schema, table), triggerExistsQuery, schema, table, trigger)
+}
+
+// AssertTriggerNotExists asserts that the table of schema does not have the trigger.
+func AssertTriggerNotExists(t assert.TestingT, db Querier, schema, table, trigger string) bool {
+	Helper(t)
+	return assertExists(t, db, false, fmt.Sprintf("trigger %s on %s.%s", trigger, schema, table), triggerExistsQuery, schema, table, trigger)
+}
+
+// AssertIndexExists asserts that the table of schema has the index.
+func AssertIndexExists(t assert.TestingT, db Querier, schema, table, index string) bool {
+	Helper(t)
+	return assertExists(t, db, true, fmt.Sprintf("index %s on %s.%s", index, schema, table), indexExistsQuery, schema, table, index)
+}
+
+// AssertIndexNotExists asserts that the table of schema does not have the index.
+func AssertIndexNotExists(t assert.TestingT, db Querier, schema, table, index string) bool {
+	Helper(t)
+	return assertExists(t, db, false, fmt.Sprintf("index %s on %s.%s", index, schema, table), indexExistsQuery, schema, table, index)
+}
+
+// assertExists asserts that query, a SELECT EXISTS, returns expected. description names what query looks for.
+func assertExists(t assert.TestingT, db Querier, expected bool, description string, query string, args ...any) bool {
+	Helper(t)
+	var exists bool
+	if err := db.QueryRow(context.Background(), query, args...).Scan(&exists); err != nil {
+		return assert.NoError(t, err, "error looking for %s", description)
+	}
+	if expected {
+		return assert.True(t, exists, "expected %s to exist", description)
+	}
+	return assert.False(t, exists, "expected %s not to exist", description)
+}
@@ -1,10 +1,11 @@
-package test
+package dbmigratetest
 
 import (
 	"github.com/pennsieve/dbmigrate-go/pkg/dbmigrate"
 	"github.com/stretchr/testify/require"
 )
 
+// Close closes migrator, failing the test if closing its source or database fails.
 func Close(t require.TestingT, migrator *dbmigrate.DatabaseMigrator) {
 	Helper(t)
 	srcErr, dbErr := migrator.Close()
@@ -1,4 +1,4 @@
-package test
+package dbmigratetest
 
 import (
 	"github.com/pennsieve/dbmigrate-go/pkg/config"
@@ -0,0 +1,42 @@
+package dbmigratetest
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// AssertGolden asserts that actual is the content of the golden file at path. If update is true, the file is
+// written with actual instead, creating its directory if needed, and the assertion passes. update is usually
+// an -update flag defined by the test package:
+//
+//	var update = flag.Bool("update", false, "update golden files")
+//
+//	dbmigratetest.AssertGolden(t, "testdata/example.golden", actual, *update)
+func AssertGolden(t testing.TB, path string, actual string, update bool) bool {
+	t.Helper()
+	if update {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(actual), 0o644))
+		return true
+	}
+	expected, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return assert.Fail(t, "golden file does not exist", "%s does not exist, run the test with -update to create it", path)
+	}
+	require.NoError(t, err)
+	return assert.Equal(t, string(expected), actual, "%s is out of date, run the test with -update to update it if the change is expected", path)
+}
+
+// AssertSchemaGolden asserts that the DumpSchema description of schema is the content of the golden file at
+// path, or writes the file if update is true. See AssertGolden.
+func AssertSchemaGolden(ctx context.Context, t testing.TB, schema *Schema, path string, update bool) bool {
+	t.Helper()
+	dump, err := schema.Migrator.DumpSchema(ctx, schema.Name)
+	require.NoError(t, err)
+	return AssertGolden(t, path, dump, update)
+}
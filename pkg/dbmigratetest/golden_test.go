@@ -0,0 +1,30 @@
+package dbmigratetest_test
+
+import (
+	"context"
+	"flag"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/pennsieve/dbmigrate-go/pkg/dbmigratetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files instead of comparing with them")
+
+func TestAssertSchemaGolden(t *testing.T) {
+	ctx := context.Background()
+	migrationsSource, err := iofs.New(os.DirFS("../dbmigrate/testdata"), "migrations")
+	require.NoError(t, err)
+
+	schema := dbmigratetest.NewSchema(ctx, t, migrationsSource)
+	dbmigratetest.AssertSchemaGolden(ctx, t, schema, "testdata/schema.golden", *update)
+}
+
+func TestAssertGolden(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "golden.txt")
+	require.NoError(t, os.WriteFile(path, []byte("table users\n"), 0o644))
+	assert.True(t, dbmigratetest.AssertGolden(t, path, "table users\n", false))
+}
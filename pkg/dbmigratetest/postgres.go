@@ -1,4 +1,4 @@
-package test
+package dbmigratetest
 
 import (
 	"context"
@@ -8,6 +8,7 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+// PostgresDB connects to a Postgres server for verifying the results of migrations.
 type PostgresDB struct {
 	host     string
 	port     int
@@ -15,12 +16,14 @@ type PostgresDB struct {
 	password string
 }
 
+// NewPostgresDBFromConfig returns a PostgresDB for the server of pgConfig, which must have a password.
 func NewPostgresDBFromConfig(t require.TestingT, pgConfig config.PostgresDBConfig) *PostgresDB {
 	Helper(t)
 	require.NotNil(t, pgConfig.Password)
 	return NewPostgresDB(pgConfig.Host, pgConfig.Port, pgConfig.User, *pgConfig.Password)
 }
 
+// NewPostgresDB returns a PostgresDB for the given server.
 func NewPostgresDB(host string, port int, user string, password string) *PostgresDB {
 	return &PostgresDB{
 		host,
@@ -30,6 +33,7 @@ func NewPostgresDB(host string, port int, user string, password string) *Postgre
 	}
 }
 
+// Connect opens a new connection to the named database. The caller closes it, for example with CloseConnection.
 func (db *PostgresDB) Connect(ctx context.Context, databaseName string) (*pgx.Conn, error) {
 	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s",
 		db.host, db.port, db.user, db.password, databaseName,
@@ -38,6 +42,7 @@ func (db *PostgresDB) Connect(ctx context.Context, databaseName string) (*pgx.Co
 	return pgx.Connect(ctx, dsn)
 }
 
+// CloseConnection closes conn, failing the test if it cannot.
 func CloseConnection(ctx context.Context, t require.TestingT, conn *pgx.Conn) {
 	Helper(t)
 	require.NoError(t, conn.Close(ctx))
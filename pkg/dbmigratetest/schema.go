@@ -0,0 +1,115 @@
+// Package dbmigratetest helps services test their migrations against a real Postgres, such as the one
+// started by docker-compose.test.yml.
+package dbmigratetest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/jackc/pgx/v5"
+	"github.com/pennsieve/dbmigrate-go/pkg/config"
+	"github.com/pennsieve/dbmigrate-go/pkg/dbmigrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// maxSchemaPrefix is how much of the test name goes into a schema name, leaving room for the random
+// suffix within Postgres' 63 byte limit on identifiers.
+const maxSchemaPrefix = 40
+
+var nonIdentifierPattern = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// Schema is a throwaway schema created by NewSchema or NewEmptySchema.
+type Schema struct {
+	// Name is the name of the schema, unique to the test.
+	Name string
+	// Config is the configuration the migrations were run with. Its schema is Name.
+	Config config.Config
+	// Migrator is the DatabaseMigrator that ran the migrations, for testing down migrations or status.
+	// It is closed when the test ends.
+	Migrator *dbmigrate.DatabaseMigrator
+	// Conn is a connection for verifying the migrations, with its search_path set to the schema.
+	// It is closed when the test ends.
+	Conn *pgx.Conn
+}
+
+// NewSchema creates a uniquely named schema for the test, applies all the migrations of
+// migrationsSource to it, and returns it. Connection settings come from the environment as for
+// config.LoadConfig, falling back to those of NewTestSettings. When the test ends the schema is
+// dropped and its connections closed.
+func NewSchema(ctx context.Context, t testing.TB, migrationsSource source.Driver, opts ...dbmigrate.Option) *Schema {
+	t.Helper()
+	schema := NewEmptySchema(ctx, t, migrationsSource, opts...)
+	require.NoError(t, schema.Migrator.UpContext(ctx))
+	return schema
+}
+
+// NewEmptySchema is NewSchema without applying the migrations.
+func NewEmptySchema(ctx context.Context, t testing.TB, migrationsSource source.Driver, opts ...dbmigrate.Option) *Schema {
+	t.Helper()
+	name := UniqueSchemaName(t)
+	migrateConfig, err := config.LoadConfig(NewTestSettings(name))
+	require.NoError(t, err)
+	// the environment's schema, if any, would otherwise take the place of the unique one
+	migrateConfig.PostgresDB.Schema = name
+
+	conn, err := NewPostgresDBFromConfig(t, migrateConfig.PostgresDB).Connect(ctx, migrateConfig.PostgresDB.Database)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		// the test's ctx may be done by now
+		cleanupCtx := context.WithoutCancel(ctx)
+		_, err := conn.Exec(cleanupCtx, fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE", pgx.Identifier{name}.Sanitize()))
+		require.NoError(t, err)
+		CloseConnection(cleanupCtx, t, conn)
+	})
+
+	// NewLocalMigrator creates the schema
+	migrator, err := dbmigrate.NewLocalMigrator(ctx, migrateConfig, migrationsSource, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		Close(t, migrator)
+	})
+
+	_, err = conn.Exec(ctx, fmt.Sprintf("SET search_path TO %s", pgx.Identifier{name}.Sanitize()))
+	require.NoError(t, err)
+
+	return &Schema{
+		Name:     name,
+		Config:   migrateConfig,
+		Migrator: migrator,
+		Conn:     conn,
+	}
+}
+
+// AssertReversible applies the migrations of migrationsSource to a new empty schema with
+// DatabaseMigrator.VerifyReversible, and asserts that each down migration reverses its up. The
+// differences left by any that do not are in the failure message. It returns the schema, fully migrated.
+func AssertReversible(ctx context.Context, t testing.TB, migrationsSource source.Driver, opts ...dbmigrate.Option) *Schema {
+	t.Helper()
+	schema := NewEmptySchema(ctx, t, migrationsSource, opts...)
+	report, err := schema.Migrator.VerifyReversible(ctx)
+	if report != nil {
+		assert.NoError(t, report.Err())
+	}
+	require.NoError(t, err)
+	return schema
+}
+
+// UniqueSchemaName returns a schema name made from the name of the test and a random suffix, so that
+// tests run in parallel, or against a database left over from an earlier run, do not collide.
+func UniqueSchemaName(t testing.TB) string {
+	t.Helper()
+	prefix := strings.Trim(nonIdentifierPattern.ReplaceAllString(strings.ToLower(t.Name()), "_"), "_")
+	if len(prefix) > maxSchemaPrefix {
+		prefix = prefix[:maxSchemaPrefix]
+	}
+	suffix := make([]byte, 4)
+	_, err := rand.Read(suffix)
+	require.NoError(t, err)
+	return fmt.Sprintf("test_%s_%s", prefix, hex.EncodeToString(suffix))
+}
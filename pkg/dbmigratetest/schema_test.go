@@ -0,0 +1,71 @@
+package dbmigratetest_test
+
+import (
+	"context"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/pennsieve/dbmigrate-go/pkg/config"
+	"github.com/pennsieve/dbmigrate-go/pkg/dbmigratetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestNewSchema(t *testing.T) {
+	ctx := context.Background()
+	migrationsSource, err := iofs.New(os.DirFS("../dbmigrate/testdata"), "migrations")
+	require.NoError(t, err)
+
+	schema := dbmigratetest.NewSchema(ctx, t, migrationsSource)
+	assert.Regexp(t, `^test_testnewschema_[0-9a-f]{8}$`, schema.Name)
+
+	dbmigratetest.AssertTableExists(t, schema.Conn, schema.Name, "test_table")
+	dbmigratetest.AssertTableNotExists(t, schema.Conn, schema.Name, "missing_table")
+	dbmigratetest.AssertColumnExists(t, schema.Conn, schema.Name, "test_table", "node_id")
+	dbmigratetest.AssertColumnNotExists(t, schema.Conn, schema.Name, "test_table", "missing_column")
+	dbmigratetest.AssertFunctionExists(t, schema.Conn, schema.Name, "update_updated_at_column")
+	dbmigratetest.AssertTriggerExists(t, schema.Conn, schema.Name, "test_table", "test_table_update_updated_at")
+	dbmigratetest.AssertIndexExists(t, schema.Conn, schema.Name, "test_table", "test_table_node_id_key")
+
+	// the search_path of Conn is the schema
+	_, err = schema.Conn.Exec(ctx, "INSERT INTO test_table (name, node_id) VALUES ('name', 'N:1')")
+	require.NoError(t, err)
+
+	require.NoError(t, schema.Migrator.DownContext(ctx))
+	dbmigratetest.AssertTableNotExists(t, schema.Conn, schema.Name, "test_table")
+	dbmigratetest.AssertFunctionNotExists(t, schema.Conn, schema.Name, "update_updated_at_column")
+}
+
+func TestNewSchema_IgnoresEnvironmentSchema(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv(config.PostgresSchemaKey, "shared_schema")
+	migrationsSource, err := iofs.New(os.DirFS("../dbmigrate/testdata"), "migrations")
+	require.NoError(t, err)
+
+	schema := dbmigratetest.NewSchema(ctx, t, migrationsSource)
+	assert.Regexp(t, `^test_testnewschema_ignoresenvironmentschema_[0-9a-f]{8}$`, schema.Name)
+	assert.Equal(t, schema.Name, schema.Config.PostgresDB.Schema)
+	dbmigratetest.AssertTableExists(t, schema.Conn, schema.Name, "test_table")
+	dbmigratetest.AssertTableNotExists(t, schema.Conn, "shared_schema", "test_table")
+}
+
+func TestUniqueSchemaName(t *testing.T) {
+	first := dbmigratetest.UniqueSchemaName(t)
+	assert.Regexp(t, `^test_testuniqueschemaname_[0-9a-f]{8}$`, first)
+	assert.NotEqual(t, first, dbmigratetest.UniqueSchemaName(t))
+
+	t.Run("Long/Name With Spaces and more words to make it longer than the limit", func(t *testing.T) {
+		name := dbmigratetest.UniqueSchemaName(t)
+		assert.LessOrEqual(t, len(name), 63)
+		assert.Regexp(t, `^test_[a-z0-9_]+_[0-9a-f]{8}$`, name)
+	})
+}
+
+func TestAssertReversible(t *testing.T) {
+	ctx := context.Background()
+	migrationsSource, err := iofs.New(os.DirFS("../dbmigrate/testdata"), "migrations")
+	require.NoError(t, err)
+
+	schema := dbmigratetest.AssertReversible(ctx, t, migrationsSource)
+	dbmigratetest.AssertTableExists(t, schema.Conn, schema.Name, "test_table")
+}
@@ -0,0 +1,12 @@
+package dbmigratetest
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+// Helper marks the caller as a test helper if t supports it, as *testing.T and testing.TB do.
+func Helper(t assert.TestingT) {
+	if h, hasHelper := t.(interface{ Helper() }); hasHelper {
+		h.Helper()
+	}
+}
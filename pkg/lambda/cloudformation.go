@@ -0,0 +1,83 @@
+package lambda
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-lambda-go/cfn"
+	"strconv"
+)
+
+// CloudFormation resource properties read by HandleCloudFormation. Both are optional, and as
+// CloudFormation passes all properties as strings, Version may be given either way. If Version is
+// given without Action, the Action is migrate.
+const (
+	ActionProperty  = "Action"
+	VersionProperty = "Version"
+)
+
+// CloudFormationHandler returns HandleCloudFormation wrapped to send its result to CloudFormation, for lambda.Start.
+func (h *Handler) CloudFormationHandler() cfn.CustomResourceLambdaFunction {
+	return cfn.LambdaWrap(h.HandleCloudFormation)
+}
+
+// HandleCloudFormation handles a custom resource event. Create and Update requests run the Action and
+// Version resource properties as Handle would, so changing the Version property of the resource
+// migrates the schema. Delete requests do nothing, so deleting the stack never rolls back the schema.
+// The returned data has the resulting Version and Dirty, and the number of migrations Applied, as strings
+// for use with Fn::GetAtt.
+func (h *Handler) HandleCloudFormation(ctx context.Context, event cfn.Event) (physicalResourceID string, data map[string]interface{}, err error) {
+	physicalResourceID = event.PhysicalResourceID
+	if len(physicalResourceID) == 0 {
+		physicalResourceID = "dbmigrate-" + event.LogicalResourceID
+	}
+	if event.RequestType == cfn.RequestDelete {
+		return physicalResourceID, nil, nil
+	}
+	request, err := requestFromProperties(event.ResourceProperties)
+	if err != nil {
+		return physicalResourceID, nil, err
+	}
+	response, err := h.Handle(ctx, request)
+	if err != nil {
+		return physicalResourceID, nil, err
+	}
+	version := ""
+	if response.HasVersion {
+		version = strconv.FormatUint(uint64(response.Version), 10)
+	}
+	return physicalResourceID, map[string]interface{}{
+		VersionProperty: version,
+		"Dirty":         strconv.FormatBool(response.Dirty),
+		"Applied":       strconv.Itoa(len(response.Applied)),
+	}, nil
+}
+
+func requestFromProperties(properties map[string]interface{}) (Request, error) {
+	var request Request
+	if action, ok := properties[ActionProperty]; ok {
+		actionString, isString := action.(string)
+		if !isString {
+			return Request{}, fmt.Errorf("resource property %s must be a string, got %v", ActionProperty, action)
+		}
+		request.Action = Action(actionString)
+	}
+	if version, ok := properties[VersionProperty]; ok {
+		var parsed int
+		switch v := version.(type) {
+		case string:
+			var err error
+			if parsed, err = strconv.Atoi(v); err != nil {
+				return Request{}, fmt.Errorf("resource property %s must be an integer, got %q", VersionProperty, v)
+			}
+		case float64:
+			parsed = int(v)
+		default:
+			return Request{}, fmt.Errorf("resource property %s must be an integer, got %v", VersionProperty, version)
+		}
+		request.Version = &parsed
+		if len(request.Action) == 0 {
+			request.Action = ActionMigrate
+		}
+	}
+	return request, nil
+}
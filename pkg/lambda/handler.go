@@ -0,0 +1,178 @@
+// Package lambda runs migrations from an AWS Lambda function, either invoked directly with a Request
+// or as a CloudFormation custom resource.
+//
+//	handler := lambda.NewHandler(lambda.RDSProxyMigratorFactory(migrateConfig, newSource, awsConfig))
+//	awslambda.Start(handler.Handle)
+//
+// or, for a custom resource,
+//
+//	awslambda.Start(handler.CloudFormationHandler())
+package lambda
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/pennsieve/dbmigrate-go/pkg/config"
+	"github.com/pennsieve/dbmigrate-go/pkg/dbmigrate"
+	"time"
+)
+
+// Action is what a Request asks the Handler to do.
+type Action string
+
+const (
+	// ActionUp applies all pending migrations. It is the default if a Request has no Action.
+	ActionUp Action = "up"
+	// ActionMigrate migrates up or down to Request.Version.
+	ActionMigrate Action = "migrate"
+	// ActionStatus reports the current version and pending migrations without changing anything.
+	ActionStatus Action = "status"
+	// ActionForce records Request.Version as applied and clean without running any migrations.
+	// Use version -1 to record that no migrations have been applied.
+	ActionForce Action = "force"
+)
+
+// Request is the payload of a direct invocation of the Handler.
+type Request struct {
+	Action Action `json:"action"`
+	// Version is the target version for ActionMigrate and ActionForce.
+	Version *int `json:"version,omitempty"`
+}
+
+// AppliedMigration is a migration run by an invocation of the Handler.
+type AppliedMigration struct {
+	dbmigrate.Migration
+	Direction dbmigrate.Direction `json:"direction"`
+	Duration  time.Duration       `json:"duration"`
+}
+
+// Response reports the state of the schema after an invocation of the Handler.
+type Response struct {
+	Action Action `json:"action"`
+	// Version is the resulting migration version. Only meaningful if HasVersion is true.
+	Version    uint `json:"version"`
+	HasVersion bool `json:"hasVersion"`
+	Dirty      bool `json:"dirty"`
+	// Applied are the migrations run by this invocation, in the order they were run.
+	Applied []AppliedMigration `json:"applied"`
+	// Pending are the migrations from the source still to be applied.
+	Pending []dbmigrate.Migration `json:"pending"`
+	// Duration is how long the invocation took, including connecting to the database.
+	Duration time.Duration `json:"duration"`
+}
+
+// MigratorFactory returns a new DatabaseMigrator configured with opts. The Handler creates a
+// DatabaseMigrator for each invocation and closes it afterwards, so the factory must return
+// a new source.Driver each time too.
+type MigratorFactory func(ctx context.Context, opts ...dbmigrate.Option) (*dbmigrate.DatabaseMigrator, error)
+
+// RDSProxyMigratorFactory returns a MigratorFactory that calls dbmigrate.NewRDSProxyDatabaseMigrator.
+func RDSProxyMigratorFactory(migrateConfig config.Config, newSource func() (source.Driver, error), awsConfig aws.Config, opts ...dbmigrate.Option) MigratorFactory {
+	return func(ctx context.Context, extraOpts ...dbmigrate.Option) (*dbmigrate.DatabaseMigrator, error) {
+		migrationsSource, err := newSource()
+		if err != nil {
+			return nil, fmt.Errorf("error creating migration source: %w", err)
+		}
+		return dbmigrate.NewRDSProxyDatabaseMigrator(ctx, migrateConfig, migrationsSource, awsConfig, append(append([]dbmigrate.Option{}, opts...), extraOpts...)...)
+	}
+}
+
+// LocalMigratorFactory returns a MigratorFactory that calls dbmigrate.NewLocalMigrator.
+func LocalMigratorFactory(migrateConfig config.Config, newSource func() (source.Driver, error), opts ...dbmigrate.Option) MigratorFactory {
+	return func(ctx context.Context, extraOpts ...dbmigrate.Option) (*dbmigrate.DatabaseMigrator, error) {
+		migrationsSource, err := newSource()
+		if err != nil {
+			return nil, fmt.Errorf("error creating migration source: %w", err)
+		}
+		return dbmigrate.NewLocalMigrator(ctx, migrateConfig, migrationsSource, append(append([]dbmigrate.Option{}, opts...), extraOpts...)...)
+	}
+}
+
+// Handler runs migrations for Lambda invocations.
+type Handler struct {
+	newMigrator MigratorFactory
+}
+
+// NewHandler returns a Handler that uses newMigrator to create a DatabaseMigrator for each invocation.
+func NewHandler(newMigrator MigratorFactory) *Handler {
+	return &Handler{newMigrator: newMigrator}
+}
+
+// Handle runs request. Its signature is suitable for lambda.Start. If ctx has a deadline, as it does
+// in Lambda, the run is stopped when it is reached. If the run fails, the Response is returned with the
+// error, reporting the migrations applied before the failure and the state they left the schema in, for
+// callers in Go. The Lambda runtime discards the Response of a failed invocation, so invokers only see
+// the error.
+func (h *Handler) Handle(ctx context.Context, request Request) (*Response, error) {
+	started := time.Now()
+	action := request.Action
+	if len(action) == 0 {
+		action = ActionUp
+	}
+	run, err := h.action(action, request.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &Response{Action: action, Applied: []AppliedMigration{}}
+	recordApplied := dbmigrate.Hooks{AfterMigration: func(_ context.Context, event dbmigrate.MigrationEvent) {
+		response.Applied = append(response.Applied, AppliedMigration{
+			Migration: dbmigrate.Migration{Version: event.Version, Identifier: event.Identifier},
+			Direction: event.Direction,
+			Duration:  event.Elapsed,
+		})
+	}}
+	migrator, err := h.newMigrator(ctx, dbmigrate.WithHooks(recordApplied))
+	if err != nil {
+		return nil, err
+	}
+	defer migrator.CloseAndLogError()
+
+	var runErr error
+	if err := run(ctx, migrator); err != nil {
+		runErr = fmt.Errorf("error running %s: %w", action, err)
+	}
+	// ctx may have ended the run, but the status is still worth reporting
+	status, err := migrator.Status(context.WithoutCancel(ctx))
+	response.Duration = time.Since(started)
+	if err != nil {
+		return response, errors.Join(runErr, fmt.Errorf("error reading status after %s: %w", action, err))
+	}
+	response.Version = status.Version
+	response.HasVersion = status.HasVersion
+	response.Dirty = status.Dirty
+	response.Pending = status.Pending
+	return response, runErr
+}
+
+// action returns the function that runs action, or an error if action or version is invalid.
+func (h *Handler) action(action Action, version *int) (func(context.Context, *dbmigrate.DatabaseMigrator) error, error) {
+	switch action {
+	case ActionUp:
+		return func(ctx context.Context, m *dbmigrate.DatabaseMigrator) error {
+			return m.UpContext(ctx)
+		}, nil
+	case ActionMigrate:
+		if version == nil || *version < 0 {
+			return nil, fmt.Errorf("%s requires a version of 0 or more", action)
+		}
+		return func(ctx context.Context, m *dbmigrate.DatabaseMigrator) error {
+			return m.MigrateContext(ctx, uint(*version))
+		}, nil
+	case ActionStatus:
+		return func(context.Context, *dbmigrate.DatabaseMigrator) error {
+			return nil
+		}, nil
+	case ActionForce:
+		if version == nil || *version < -1 {
+			return nil, fmt.Errorf("%s requires a version of -1 or more", action)
+		}
+		return func(_ context.Context, m *dbmigrate.DatabaseMigrator) error {
+			return m.Force(*version)
+		}, nil
+	}
+	return nil, errors.New("unknown action: " + string(action))
+}
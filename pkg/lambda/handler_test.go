@@ -0,0 +1,217 @@
+package lambda_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/cfn"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/pennsieve/dbmigrate-go/pkg/config"
+	"github.com/pennsieve/dbmigrate-go/pkg/dbmigrate"
+	"github.com/pennsieve/dbmigrate-go/pkg/dbmigratetest"
+	"github.com/pennsieve/dbmigrate-go/pkg/lambda"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+const schema = "lambda_test_schema"
+
+const (
+	firstVersion  = 20250319124829
+	secondVersion = 20250509172500
+)
+
+func newSource() (source.Driver, error) {
+	return iofs.New(os.DirFS("../dbmigrate/testdata/migrations"), ".")
+}
+
+// newFailingSource returns a source whose second migration always fails part way through
+func newFailingSource() (source.Driver, error) {
+	return iofs.New(os.DirFS("../dbmigrate/testdata/failing_migrations"), ".")
+}
+
+// newTestHandler returns a Handler for the local test database, and drops the schema's tables when the test completes
+func newTestHandler(t *testing.T) *lambda.Handler {
+	t.Helper()
+	return newTestHandlerWithSource(t, newSource)
+}
+
+// newTestHandlerWithSource is newTestHandler for the migrations of newSource
+func newTestHandlerWithSource(t *testing.T, newSource func() (source.Driver, error)) *lambda.Handler {
+	t.Helper()
+	migrateConfig, err := config.LoadConfig(dbmigratetest.NewTestSettings(schema))
+	require.NoError(t, err)
+	factory := lambda.LocalMigratorFactory(migrateConfig, newSource)
+	t.Cleanup(func() {
+		migrator, err := factory(context.Background())
+		require.NoError(t, err)
+		require.NoError(t, migrator.Drop())
+		dbmigratetest.Close(t, migrator)
+	})
+	return lambda.NewHandler(factory)
+}
+
+func version(v int) *int {
+	return &v
+}
+
+func TestHandler_Handle(t *testing.T) {
+	ctx := context.Background()
+	handler := newTestHandler(t)
+
+	response, err := handler.Handle(ctx, lambda.Request{Action: lambda.ActionStatus})
+	require.NoError(t, err)
+	assert.False(t, response.HasVersion)
+	assert.Empty(t, response.Applied)
+	assert.Len(t, response.Pending, 2)
+
+	// up is the default action
+	response, err = handler.Handle(ctx, lambda.Request{})
+	require.NoError(t, err)
+	assert.Equal(t, lambda.ActionUp, response.Action)
+	assert.True(t, response.HasVersion)
+	assert.Equal(t, uint(secondVersion), response.Version)
+	assert.False(t, response.Dirty)
+	assert.Empty(t, response.Pending)
+	require.Len(t, response.Applied, 2)
+	assert.Equal(t, dbmigrate.Migration{Version: firstVersion, Identifier: "create_updated_at_trigger"}, response.Applied[0].Migration)
+	assert.Equal(t, dbmigrate.DirectionUp, response.Applied[0].Direction)
+	assert.Equal(t, dbmigrate.Migration{Version: secondVersion, Identifier: "create_table"}, response.Applied[1].Migration)
+	assert.Positive(t, response.Duration)
+
+	response, err = handler.Handle(ctx, lambda.Request{Action: lambda.ActionMigrate, Version: version(firstVersion)})
+	require.NoError(t, err)
+	assert.Equal(t, uint(firstVersion), response.Version)
+	require.Len(t, response.Applied, 1)
+	assert.Equal(t, dbmigrate.DirectionDown, response.Applied[0].Direction)
+	assert.Equal(t, uint(secondVersion), response.Applied[0].Version)
+	assert.Len(t, response.Pending, 1)
+
+	response, err = handler.Handle(ctx, lambda.Request{Action: lambda.ActionForce, Version: version(-1)})
+	require.NoError(t, err)
+	assert.False(t, response.HasVersion)
+	assert.Empty(t, response.Applied)
+}
+
+func TestHandler_Handle_FailedMigration(t *testing.T) {
+	ctx := context.Background()
+	handler := newTestHandlerWithSource(t, newFailingSource)
+
+	response, err := handler.Handle(ctx, lambda.Request{Action: lambda.ActionUp})
+	require.Error(t, err)
+	require.NotNil(t, response)
+	assert.Equal(t, lambda.ActionUp, response.Action)
+	assert.True(t, response.HasVersion)
+	assert.Equal(t, uint(20250601110000), response.Version)
+	assert.True(t, response.Dirty)
+	require.Len(t, response.Applied, 1)
+	assert.Equal(t, dbmigrate.Migration{Version: 20250601100000, Identifier: "create_recover_table"}, response.Applied[0].Migration)
+	assert.Positive(t, response.Duration)
+}
+
+func TestHandler_Handle_InvalidRequest(t *testing.T) {
+	handler := lambda.NewHandler(func(context.Context, ...dbmigrate.Option) (*dbmigrate.DatabaseMigrator, error) {
+		require.FailNow(t, "invalid requests should not connect")
+		return nil, nil
+	})
+	tests := []struct {
+		scenario string
+		request  lambda.Request
+	}{
+		{"unknown action", lambda.Request{Action: "sideways"}},
+		{"migrate without version", lambda.Request{Action: lambda.ActionMigrate}},
+		{"migrate to negative version", lambda.Request{Action: lambda.ActionMigrate, Version: version(-1)}},
+		{"force without version", lambda.Request{Action: lambda.ActionForce}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			_, err := handler.Handle(context.Background(), tt.request)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestHandler_RequestJSON(t *testing.T) {
+	var request lambda.Request
+	require.NoError(t, json.Unmarshal([]byte(`{"action": "migrate", "version": 20250319124829}`), &request))
+	assert.Equal(t, lambda.ActionMigrate, request.Action)
+	require.NotNil(t, request.Version)
+	assert.Equal(t, firstVersion, *request.Version)
+}
+
+// cloudFormationResponses is a stand-in for the pre-signed S3 URL CloudFormation expects custom resources to respond to
+func cloudFormationResponses(t *testing.T) (url string, responses <-chan cfn.Response) {
+	t.Helper()
+	received := make(chan cfn.Response, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		var response cfn.Response
+		assert.NoError(t, json.Unmarshal(body, &response))
+		received <- response
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, received
+}
+
+func TestHandler_CloudFormation(t *testing.T) {
+	ctx := context.Background()
+	handler := newTestHandler(t).CloudFormationHandler()
+
+	tests := []struct {
+		scenario        string
+		requestType     cfn.RequestType
+		properties      map[string]interface{}
+		expectedStatus  cfn.StatusType
+		expectedVersion string
+	}{
+		{"create migrates up", cfn.RequestCreate, map[string]interface{}{}, cfn.StatusSuccess, "20250509172500"},
+		{"version without action migrates to it", cfn.RequestUpdate,
+			map[string]interface{}{"Version": "20250319124829"}, cfn.StatusSuccess, "20250319124829"},
+		{"update to the latest version", cfn.RequestUpdate, map[string]interface{}{}, cfn.StatusSuccess, "20250509172500"},
+		{"update to an earlier version", cfn.RequestUpdate,
+			map[string]interface{}{"Action": "migrate", "Version": "20250319124829"}, cfn.StatusSuccess, "20250319124829"},
+		{"invalid version", cfn.RequestUpdate,
+			map[string]interface{}{"Action": "migrate", "Version": "latest"}, cfn.StatusFailed, ""},
+		{"delete leaves schema alone", cfn.RequestDelete, map[string]interface{}{}, cfn.StatusSuccess, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			url, responses := cloudFormationResponses(t)
+			properties := map[string]interface{}{"ServiceToken": "arn:aws:lambda:us-east-1:123456789012:function:migrate"}
+			for k, v := range tt.properties {
+				properties[k] = v
+			}
+			event := cfn.Event{
+				RequestType:        tt.requestType,
+				RequestID:          "request-id",
+				ResponseURL:        url,
+				ResourceType:       "Custom::DatabaseMigration",
+				LogicalResourceID:  "DatabaseMigration",
+				StackID:            "arn:aws:cloudformation:us-east-1:123456789012:stack/test/id",
+				ResourceProperties: properties,
+			}
+			if tt.requestType != cfn.RequestCreate {
+				event.PhysicalResourceID = "dbmigrate-DatabaseMigration"
+			}
+
+			_, err := handler(ctx, event)
+			require.NoError(t, err)
+
+			response := <-responses
+			assert.Equal(t, tt.expectedStatus, response.Status, response.Reason)
+			assert.Equal(t, "dbmigrate-DatabaseMigration", response.PhysicalResourceID)
+			assert.Equal(t, "request-id", response.RequestID)
+			if len(tt.expectedVersion) > 0 {
+				assert.Equal(t, tt.expectedVersion, response.Data["Version"])
+				assert.Equal(t, "false", response.Data["Dirty"])
+			}
+		})
+	}
+}